@@ -4,10 +4,6 @@ const (
 	NotFindString = "404 page not found\n"
 )
 
-var (
-	ListenPort int = 4000
-)
-
 type TestUser struct {
 	Name  string
 	Age   int
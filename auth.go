@@ -0,0 +1,165 @@
+package pong
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"strconv"
+)
+
+// default header name to read API key from
+const APIKeyHeader = "X-API-Key"
+
+// Principal is who is authenticated by BasicAuth, APIKeyAuth or JWT
+type Principal struct {
+	// who is authenticated, like user name, API key's owner or JWT's sub
+	Subject string
+	// how it's authenticated, "basic" "apikey" or "jwt"
+	Scheme string
+	// roles and scopes the principal has, they are used by RoleAuthorizer
+	Roles  []string
+	Scopes []string
+	// more info about the principal, like JWT's claims
+	Claims map[string]interface{}
+}
+
+// Key to store the Principal authenticated by BasicAuth, APIKeyAuth and JWT in Context
+var PrincipalKey = NewKey[*Principal]("principal")
+
+// return the Principal authenticated in this request, nil if request is not authenticated
+func (c *Context) Principal() *Principal {
+	principal, _ := PrincipalKey.Get(c)
+	return principal
+}
+
+// return a copy of the Principal with Scheme set if it has no Scheme
+// the Principal return by user's callback may be shared by requests, so it's never changed
+func (principal *Principal) withScheme(scheme string) *Principal {
+	if len(principal.Scheme) > 0 {
+		return principal
+	}
+	copied := *principal
+	copied.Scheme = scheme
+	return &copied
+}
+
+// stop request with ErrorUnauthorized, and tell client how to authenticate by WWW-Authenticate header
+func (c *Context) unauthorized(challenge string) {
+	c.Response.HTTPResponseWriter.Header().Set("WWW-Authenticate", challenge)
+	c.Abort(ErrorUnauthorized)
+}
+
+// BasicAuthOptions config BasicAuth Middleware
+type BasicAuthOptions struct {
+	// realm send to client in WWW-Authenticate header, default is "Restricted"
+	Realm string
+	// return the Principal if username and password are valid, return nil if not
+	// compare password by BasicAuthUsers or subtle.ConstantTimeCompare to avoid timing attack
+	Validate func(c *Context, username string, password string) *Principal
+}
+
+// make a Middleware authenticate request by HTTP Basic auth
+// request fail to pass is stopped and ErrorUnauthorized is give to HTTPErrorHandle with WWW-Authenticate header
+// the authenticated Principal is set to Context by PrincipalKey
+func BasicAuth(options BasicAuthOptions) HandleFunc {
+	realm := options.Realm
+	if len(realm) == 0 {
+		realm = "Restricted"
+	}
+	challenge := "Basic realm=" + strconv.Quote(realm) + `, charset="UTF-8"`
+	return func(c *Context) {
+		username, password, ok := c.Request.HTTPRequest.BasicAuth()
+		var principal *Principal
+		if ok {
+			principal = options.Validate(c, username, password)
+		}
+		if principal == nil {
+			c.unauthorized(challenge)
+		}
+		PrincipalKey.Set(c, principal.withScheme("basic"))
+	}
+}
+
+// return a BasicAuthOptions.Validate which check username and password in users map[username]password
+// password is compared in constant time, and unknown username takes the same time as wrong password
+func BasicAuthUsers(users map[string]string) func(c *Context, username string, password string) *Principal {
+	hashed := make(map[string][sha256.Size]byte, len(users))
+	for username, password := range users {
+		hashed[username] = sha256.Sum256([]byte(password))
+	}
+	return func(c *Context, username string, password string) *Principal {
+		expected, has := hashed[username]
+		given := sha256.Sum256([]byte(password))
+		if subtle.ConstantTimeCompare(expected[:], given[:]) != 1 || !has {
+			return nil
+		}
+		return &Principal{Subject: username}
+	}
+}
+
+// APIKeyOptions config APIKeyAuth Middleware
+type APIKeyOptions struct {
+	// header to read API key from, default is APIKeyHeader
+	Header string
+	// query param to read API key from if header has no key, empty means API key is not read from query
+	// key in URL may be logged by proxies, only use it when client can't send header
+	Query string
+	// also read API key from `Authorization: Bearer <key>`
+	Bearer bool
+	// return the Principal own the key, return nil Principal if key is invalid
+	// error is give to HTTPErrorHandle, like the key store is down
+	Lookup func(c *Context, key string) (*Principal, error)
+}
+
+// make a Middleware authenticate request by API key
+// request fail to pass is stopped and ErrorUnauthorized is give to HTTPErrorHandle
+// the authenticated Principal is set to Context by PrincipalKey
+func APIKeyAuth(options APIKeyOptions) HandleFunc {
+	header := options.Header
+	if len(header) == 0 {
+		header = APIKeyHeader
+	}
+	return func(c *Context) {
+		request := c.Request.HTTPRequest
+		key := request.Header.Get(header)
+		if len(key) == 0 && options.Bearer {
+			key = bearerToken(request)
+		}
+		if len(key) == 0 && len(options.Query) > 0 {
+			key = request.URL.Query().Get(options.Query)
+		}
+		var principal *Principal
+		if len(key) > 0 {
+			var err error
+			if principal, err = options.Lookup(c, key); err != nil {
+				c.Abort(err)
+			}
+		}
+		if principal == nil {
+			c.Abort(ErrorUnauthorized)
+		}
+		PrincipalKey.Set(c, principal.withScheme("apikey"))
+	}
+}
+
+// return an APIKeyOptions.Lookup which find key in keys map[key]subject, key is compared in constant time
+func APIKeys(keys map[string]string) func(c *Context, key string) (*Principal, error) {
+	type apiKey struct {
+		hash    [sha256.Size]byte
+		subject string
+	}
+	hashed := make([]apiKey, 0, len(keys))
+	for key, subject := range keys {
+		hashed = append(hashed, apiKey{sha256.Sum256([]byte(key)), subject})
+	}
+	return func(c *Context, key string) (*Principal, error) {
+		given := sha256.Sum256([]byte(key))
+		var principal *Principal
+		// check every key so time taken not tell which key is near
+		for _, k := range hashed {
+			if subtle.ConstantTimeCompare(k.hash[:], given[:]) == 1 {
+				principal = &Principal{Subject: k.subject}
+			}
+		}
+		return principal, nil
+	}
+}
@@ -0,0 +1,202 @@
+package pong
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// send a GET request with header, return response's status code and the WWW-Authenticate header
+func authRequest(t *testing.T, url string, header map[string]string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode, res.Header.Get("WWW-Authenticate")
+}
+
+func TestBasicAuthAndAPIKey(t *testing.T) {
+	po, baseURL := runPong()
+	whoami := func(c *Context) {
+		principal := c.Principal()
+		c.Response.String(principal.Scheme + ":" + principal.Subject)
+	}
+	basic := po.Root.Router("/basic")
+	basic.Middleware(BasicAuth(BasicAuthOptions{
+		Realm:    "admin",
+		Validate: BasicAuthUsers(map[string]string{"hal": "secret"}),
+	}))
+	basic.Get("/whoami", whoami)
+	api := po.Root.Router("/api")
+	api.Middleware(APIKeyAuth(APIKeyOptions{Query: "api_key", Bearer: true, Lookup: APIKeys(map[string]string{"k1": "service"})}))
+	api.Get("/whoami", whoami)
+	broken := po.Root.Router("/broken")
+	broken.Middleware(APIKeyAuth(APIKeyOptions{Lookup: func(c *Context, key string) (*Principal, error) {
+		return nil, errors.New("key store is down")
+	}}))
+	broken.Get("/whoami", whoami)
+	// Principal return by Lookup is shared by requests, it should never be changed
+	shared := &Principal{Subject: "shared"}
+	cached := po.Root.Router("/cached")
+	cached.Middleware(APIKeyAuth(APIKeyOptions{Lookup: func(c *Context, key string) (*Principal, error) {
+		return shared, nil
+	}}))
+	cached.Get("/whoami", whoami)
+
+	code, challenge := authRequest(t, baseURL+"/basic/whoami", nil)
+	if code != http.StatusUnauthorized || challenge != `Basic realm="admin", charset="UTF-8"` {
+		t.Error(code, challenge)
+	}
+	for _, auth := range []string{"hal:wrong", "nobody:secret", "hal:secre"} {
+		req, _ := http.NewRequest(http.MethodGet, baseURL+"/basic/whoami", nil)
+		parts := strings.SplitN(auth, ":", 2)
+		req.SetBasicAuth(parts[0], parts[1])
+		if res, _ := http.DefaultClient.Do(req); res.StatusCode != http.StatusUnauthorized {
+			t.Error(auth, res.StatusCode)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/basic/whoami", nil)
+	req.SetBasicAuth("hal", "secret")
+	assertBody(t, req, "basic:hal")
+
+	for _, header := range []map[string]string{nil, {APIKeyHeader: "bad"}, {"Authorization": "Bearer bad"}} {
+		if code, _ := authRequest(t, baseURL+"/api/whoami", header); code != http.StatusUnauthorized {
+			t.Error(header, code)
+		}
+	}
+	req, _ = http.NewRequest(http.MethodGet, baseURL+"/api/whoami", nil)
+	req.Header.Set(APIKeyHeader, "k1")
+	assertBody(t, req, "apikey:service")
+	req, _ = http.NewRequest(http.MethodGet, baseURL+"/api/whoami", nil)
+	req.Header.Set("Authorization", "Bearer k1")
+	assertBody(t, req, "apikey:service")
+	req, _ = http.NewRequest(http.MethodGet, baseURL+"/api/whoami?api_key=k1", nil)
+	assertBody(t, req, "apikey:service")
+
+	req, _ = http.NewRequest(http.MethodGet, baseURL+"/cached/whoami", nil)
+	req.Header.Set(APIKeyHeader, "k1")
+	assertBody(t, req, "apikey:shared")
+	if len(shared.Scheme) != 0 {
+		t.Error("shared Principal is changed", shared.Scheme)
+	}
+
+	// Lookup's error is give to HTTPErrorHandle
+	if code, _ := authRequest(t, baseURL+"/broken/whoami", map[string]string{APIKeyHeader: "k1"}); code != http.StatusInternalServerError {
+		t.Error(code)
+	}
+}
+
+func assertBody(t *testing.T, req *http.Request, body string) {
+	t.Helper()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := make([]byte, 64)
+	n, _ := res.Body.Read(bs)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(bs[:n]) != body {
+		t.Error(res.StatusCode, string(bs[:n]), "want", body)
+	}
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hsKey := []byte("0123456789abcdef0123456789abcdef")
+	options := JWTOptions{
+		Keys: map[string]interface{}{
+			"hs":  hsKey,
+			"rs":  &rsaKey.PublicKey,
+			"es":  &ecKey.PublicKey,
+			"old": []byte("old key"),
+		},
+		Issuer:   "pong",
+		Audience: "api",
+		Leeway:   time.Minute,
+	}
+	now := time.Now().Unix()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "hal",
+			"iss":   "pong",
+			"aud":   []string{"web", "api"},
+			"exp":   now + 60,
+			"roles": []string{"admin"},
+			"scope": "read write",
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	sign := func(claims map[string]interface{}, kid string, key interface{}) string {
+		token, err := SignJWT(claims, kid, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	for kid, key := range map[string]interface{}{"hs": hsKey, "rs": rsaKey, "es": ecKey, "old": []byte("old key")} {
+		if _, err := VerifyJWT(sign(claims(nil), kid, key), options); err != nil {
+			t.Error(kid, err)
+		}
+	}
+	invalid := map[string]string{
+		"expired":           sign(claims(map[string]interface{}{"exp": now - 120}), "hs", hsKey),
+		"not valid yet":     sign(claims(map[string]interface{}{"nbf": now + 120}), "hs", hsKey),
+		"wrong issuer":      sign(claims(map[string]interface{}{"iss": "evil"}), "hs", hsKey),
+		"wrong audience":    sign(claims(map[string]interface{}{"aud": "web"}), "hs", hsKey),
+		"unknown kid":       sign(claims(nil), "new", hsKey),
+		"wrong key":         sign(claims(nil), "hs", []byte("wrong")),
+		"algorithm of kid":  sign(claims(nil), "rs", hsKey),
+		"tampered payload":  strings.Replace(sign(claims(nil), "es", ecKey), ".", ".e", 1),
+		"malformed":         "a.b",
+		"alg none":          "eyJhbGciOiJub25lIiwia2lkIjoiaHMifQ.eyJzdWIiOiJoYWwifQ.",
+		"tampered rsa sign": sign(claims(nil), "rs", rsaKey) + "A",
+	}
+	for name, token := range invalid {
+		if _, err := VerifyJWT(token, options); !errors.Is(err, ErrorInvalidJWT) {
+			t.Error(name, "should be invalid", err)
+		}
+	}
+	// leeway allow small clock skew
+	if _, err := VerifyJWT(sign(claims(map[string]interface{}{"exp": now - 30}), "hs", hsKey), options); err != nil {
+		t.Error(err)
+	}
+
+	po, baseURL := runPong()
+	po.Root.Middleware(JWT(options))
+	po.Root.Get("/whoami", func(c *Context) {
+		principal := c.Principal()
+		c.Response.String(principal.Subject + " " + strings.Join(principal.Roles, ",") + " " + strings.Join(principal.Scopes, ","))
+	})
+	if code, challenge := authRequest(t, baseURL+"/whoami", nil); code != http.StatusUnauthorized || challenge != "Bearer" {
+		t.Error(code, challenge)
+	}
+	if code, challenge := authRequest(t, baseURL+"/whoami", map[string]string{"Authorization": "Bearer " + invalid["expired"]}); code != http.StatusUnauthorized || challenge != `Bearer error="invalid_token"` {
+		t.Error(code, challenge)
+	}
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(claims(nil), "es", ecKey))
+	assertBody(t, req, "hal admin read,write")
+}
@@ -0,0 +1,131 @@
+package pong
+
+import (
+	"sort"
+)
+
+// Authorizer decide whether an authenticated Principal can access a route require permissions,
+// pong.Authorizer is used to check permissions set by Router.Require and Router.RequireRoute
+type Authorizer interface {
+	// return true if principal has every permission in required, error is give to HTTPErrorHandle
+	Authorize(c *Context, principal *Principal, required []string) (bool, error)
+}
+
+// AuthorizerFunc adapt a function to Authorizer
+type AuthorizerFunc func(c *Context, principal *Principal, required []string) (bool, error)
+
+func (f AuthorizerFunc) Authorize(c *Context, principal *Principal, required []string) (bool, error) {
+	return f(c, principal, required)
+}
+
+// RoleAuthorizer is the default Authorizer, a permission is granted if it's one of Principal's Roles or Scopes
+type RoleAuthorizer struct{}
+
+func (RoleAuthorizer) Authorize(c *Context, principal *Principal, required []string) (bool, error) {
+	for _, permission := range required {
+		if !hasString(principal.Roles, permission) && !hasString(principal.Scopes, permission) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// require permissions to access every handle register in this router and it's sub routers
+// permissions of parent routers and route are all required
+// they are checked after all Middleware execute, so authentication Middleware of this router can set Principal first
+// if request has no Principal ErrorUnauthorized is give to HTTPErrorHandle, if Authorizer refuse it ErrorForbidden is give
+func (r *Router) Require(permissions ...string) {
+	r.required = append(r.required, permissions...)
+}
+
+// require permissions to access the handle register to path and method in this router, works like Router.Require
+func (r *Router) RequireRoute(method string, path string, permissions ...string) {
+	steps := splitPath(path)
+	router := r
+	if len(steps) > 1 {
+		router = r.registerRouter(steps[:len(steps)-1])
+	}
+	key := subHandlesMapKey{steps[len(steps)-1], method}
+	if len(key.path) > 0 && key.path[0] == ':' {
+		key.path = ":"
+	}
+	if router.routeRequired == nil {
+		router.routeRequired = make(map[subHandlesMapKey][]string)
+	}
+	router.routeRequired[key] = append(router.routeRequired[key], permissions...)
+}
+
+// check permissions required by routers and route before handle execute
+func (c *Context) authorize(required []string) {
+	if len(required) == 0 {
+		return
+	}
+	principal := c.Principal()
+	if principal == nil {
+		c.Abort(ErrorUnauthorized)
+	}
+	ok, err := c.pong.Authorizer.Authorize(c, principal, required)
+	if err != nil {
+		c.Abort(err)
+	}
+	if !ok {
+		c.Abort(ErrorForbidden)
+	}
+}
+
+// RouteInfo describe a registered route, it's used to list routes and their permissions
+type RouteInfo struct {
+	Method string `json:"method"`
+	// path like /users/:id
+	Path string `json:"path"`
+	// permissions required by routers and route, nil if route is public
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// return all registered routes sorted by path and method, with permissions required to access them
+// it can be used to generate a permissions matrix
+func (pong *Pong) Routes() []RouteInfo {
+	var routes []RouteInfo
+	pong.Root.routes("", nil, &routes)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func (r *Router) routes(prefix string, required []string, routes *[]RouteInfo) {
+	required = append(required[:len(required):len(required)], r.required...)
+	for key := range r.subHandlesMap {
+		path := key.path
+		if path == ":" {
+			path = ":" + r.paramName
+		}
+		permissions := append(required[:len(required):len(required)], r.routeRequired[key]...)
+		if len(permissions) == 0 {
+			permissions = nil
+		}
+		*routes = append(*routes, RouteInfo{
+			Method:      key.method,
+			Path:        prefix + "/" + path,
+			Permissions: permissions,
+		})
+	}
+	for step, sub := range r.subRoutersMap {
+		if step == ":" {
+			step = ":" + r.paramName
+		}
+		sub.routes(prefix+"/"+step, required, routes)
+	}
+}
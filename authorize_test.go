@@ -0,0 +1,79 @@
+package pong
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	po, baseURL := runPong()
+	// a fake authentication, principal's roles come from header
+	po.Root.Middleware(func(c *Context) {
+		if roles := c.Request.HTTPRequest.Header["X-Roles"]; roles != nil {
+			PrincipalKey.Set(c, &Principal{Subject: "hal", Roles: roles})
+		}
+	})
+	ok := func(c *Context) {
+		c.Response.String("ok")
+	}
+	po.Root.Get("/", ok)
+	admin := po.Root.Router("/admin")
+	admin.Require("admin")
+	admin.Get("/users", ok)
+	admin.Delete("/users/:id", ok)
+	admin.RequireRoute(http.MethodDelete, "/users/:id", "users:delete")
+	audit := admin.Router("/audit")
+	audit.Require("auditor")
+	audit.Get("/logs", ok)
+
+	cases := []struct {
+		method string
+		path   string
+		roles  []string
+		code   int
+	}{
+		{http.MethodGet, "/", nil, http.StatusOK},
+		{http.MethodGet, "/admin/users", nil, http.StatusUnauthorized},
+		{http.MethodGet, "/admin/users", []string{"user"}, http.StatusForbidden},
+		{http.MethodGet, "/admin/users", []string{"admin"}, http.StatusOK},
+		{http.MethodDelete, "/admin/users/1", []string{"admin"}, http.StatusForbidden},
+		{http.MethodDelete, "/admin/users/1", []string{"admin", "users:delete"}, http.StatusOK},
+		{http.MethodGet, "/admin/audit/logs", []string{"auditor"}, http.StatusForbidden},
+		{http.MethodGet, "/admin/audit/logs", []string{"admin", "auditor"}, http.StatusOK},
+		// not find is not hidden by authorization
+		{http.MethodGet, "/admin/none", nil, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, baseURL+c.path, nil)
+		for _, role := range c.roles {
+			req.Header.Add("X-Roles", role)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Error(c.method, c.path, c.roles, res.StatusCode, "want", c.code)
+		}
+	}
+
+	// custom Authorizer
+	po.Authorizer = AuthorizerFunc(func(c *Context, principal *Principal, required []string) (bool, error) {
+		return principal.Subject == "hal", nil
+	})
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/admin/audit/logs", nil)
+	req.Header.Set("X-Roles", "none")
+	assertBody(t, req, "ok")
+
+	expected := []RouteInfo{
+		{Method: http.MethodGet, Path: "/"},
+		{Method: http.MethodGet, Path: "/admin/audit/logs", Permissions: []string{"admin", "auditor"}},
+		{Method: http.MethodGet, Path: "/admin/users", Permissions: []string{"admin"}},
+		{Method: http.MethodDelete, Path: "/admin/users/:id", Permissions: []string{"admin", "users:delete"}},
+	}
+	if routes := po.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Error(routes)
+	}
+}
@@ -1,13 +1,34 @@
 package pong
 
-import "net/http"
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
 
 // Context represents context for the current request. It holds request and
 // response objects, path parameters, data and registered handler.
 // Context is handle by middleware list in order
+//
+// Context implement context.Context, Deadline Done and Err come from HTTPRequest's context,
+// so it can be pass to any function which want a context.Context like database call
 type Context struct {
 	pong      *Pong
-	dataStore map[string]interface{}
+	dataLock  sync.RWMutex
+	dataStore map[interface{}]interface{}
+	timeout   time.Duration
+	// SessionTransport of the router handle this request
+	sessionTransport SessionTransport
+	// permissions required by routers handle this request
+	required []string
+	// template funcs bind to this request, they overwrite funcs with the same name when Render
+	templateFuncs template.FuncMap
+	// Session is still used by a timeout handle, the handle release Session's lock when it return
+	sessionDetached bool
+	// Context response to client instead of this one after a timeout handle has timeout
+	forked *Context
 	// HTTP Session
 	Session *Session
 	// HTTP Request,used to get params like query post-form post-file...
@@ -16,30 +37,113 @@ type Context struct {
 	Response *Response
 }
 
+// panic with it to stop the running Middleware or handle, pong will recover it
+type handleAbort struct {
+	err error
+}
+
 func newContext(pong *Pong, writer http.ResponseWriter, request *http.Request) *Context {
 	context := &Context{
 		pong:      pong,
-		dataStore: make(map[string]interface{}),
+		dataStore: make(map[interface{}]interface{}),
 		Request: &Request{
 			HTTPRequest:     request,
 			requestParamMap: make(map[string]string),
 		},
 		Response: &Response{
-			HTTPResponseWriter: writer,
-			StatusCode:         http.StatusOK,
+			StatusCode: http.StatusOK,
 		}}
 	context.Response.context = context
+	context.Response.writer = &responseWriter{
+		ResponseWriter: writer,
+		response:       context.Response,
+	}
+	context.Response.HTTPResponseWriter = context.Response.writer
 	return context
 }
 
 // get a value which is set by Context.Set() method.
 // if the give name is not store a nil will return
 func (c *Context) Get(name string) interface{} {
-	return c.dataStore[name]
+	value, _ := c.load(name)
+	return value
 }
 
 // set a value to this context in a handle,and in next handle you can read the value by Context.Get()
 // the data is store with type map[string]interface{} in memory,so set a same can overwrite old value
+// value set here can also be read by Context.Value() with a string key
 func (c *Context) Set(name string, value interface{}) {
-	c.dataStore[name] = value
+	c.store(name, value)
+}
+
+func (c *Context) load(key interface{}) (value interface{}, has bool) {
+	c.dataLock.RLock()
+	defer c.dataLock.RUnlock()
+	value, has = c.dataStore[key]
+	return
+}
+
+func (c *Context) store(key interface{}, value interface{}) {
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+	c.dataStore[key] = value
+}
+
+// implement context.Context, return HTTPRequest's context Deadline
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	return c.Request.HTTPRequest.Context().Deadline()
+}
+
+// implement context.Context, the returned channel will be closed when client disconnect,
+// request timeout or the request has been handled
+func (c *Context) Done() <-chan struct{} {
+	return c.Request.HTTPRequest.Context().Done()
+}
+
+// implement context.Context, return why Done channel is closed
+func (c *Context) Err() error {
+	return c.Request.HTTPRequest.Context().Err()
+}
+
+// implement context.Context
+// if key is a string or a Key and has been set by Context.Set() or Key.Set() return it,
+// else look up the value in HTTPRequest's context which may be set by upstream middleware
+func (c *Context) Value(key interface{}) interface{} {
+	switch key.(type) {
+	case string, typedKey:
+		if value, has := c.load(key); has {
+			return value
+		}
+	}
+	return c.Request.HTTPRequest.Context().Value(key)
+}
+
+// set a timeout to this request, after timeout Done channel will be closed
+// the new deadline will also set to HTTPRequest's context so everything use Context or HTTPRequest will see it
+// call the returned cancel function to release resources as soon as operation running in this Context complete
+func (c *Context) WithTimeout(timeout time.Duration) context.CancelFunc {
+	return c.WithDeadline(time.Now().Add(timeout))
+}
+
+// set a deadline to this request, works like Context.WithTimeout
+func (c *Context) WithDeadline(deadline time.Time) context.CancelFunc {
+	ctx, cancel := context.WithDeadline(c.Request.HTTPRequest.Context(), deadline)
+	c.Request.HTTPRequest = c.Request.HTTPRequest.WithContext(ctx)
+	return cancel
+}
+
+// make this request can be canceled by the returned cancel function, Done channel will be closed after cancel
+func (c *Context) WithCancel() context.CancelFunc {
+	ctx, cancel := context.WithCancel(c.Request.HTTPRequest.Context())
+	c.Request.HTTPRequest = c.Request.HTTPRequest.WithContext(ctx)
+	return cancel
+}
+
+// stop handling this request now, Middleware and handle after the caller will not execute
+// err is give to HTTPErrorHandle if response has not been send, pass nil if the caller has made the response itself
+// it can also be called in BeforeSend handles and TailMiddleware, then err is send instead of what the running handle write,
+// in AfterSend handles and AfterResponse handles response has been send, Abort only skip the rest of them
+// Abort works by panic, so don't call it in a goroutine not run by pong
+func (c *Context) Abort(err error) {
+	panic(&handleAbort{err})
 }
@@ -1,9 +1,11 @@
 package pong
 
 import (
+	"context"
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 	"github.com/gwuhaolin/pong/_test"
 )
 
@@ -32,3 +34,86 @@ func TestContext(t *testing.T) {
 	})
 	defer http.Get(baseURL + "/user")
 }
+
+type testContextKey string
+
+func TestStdContext(t *testing.T) {
+	po, baseURL := runPong()
+	root := po.Root
+	root.Middleware(func(c *Context) {
+		ctx := context.WithValue(c.Request.HTTPRequest.Context(), testContextKey("upstream"), "up")
+		c.Request.HTTPRequest = c.Request.HTTPRequest.WithContext(ctx)
+		c.Set("name", "pong")
+	})
+	root.Get("/ctx", func(c *Context) {
+		var ctx context.Context = c
+		if ctx.Value("name") != "pong" {
+			t.Error(ctx.Value("name"))
+		}
+		if ctx.Value(testContextKey("upstream")) != "up" {
+			t.Error(ctx.Value(testContextKey("upstream")))
+		}
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("should has no deadline")
+		}
+		cancel := c.WithTimeout(10 * time.Millisecond)
+		defer cancel()
+		if _, ok := c.Request.HTTPRequest.Context().Deadline(); !ok {
+			t.Error("deadline should propagate into HTTPRequest")
+		}
+		select {
+		case <-c.Done():
+			if c.Err() != context.DeadlineExceeded {
+				t.Error(c.Err())
+			}
+		case <-time.After(time.Second):
+			t.Error("Done should be closed after timeout")
+		}
+		c.Response.String("")
+		t.Log(`TestStdContext`)
+	})
+	defer http.Get(baseURL + "/ctx")
+}
+
+func TestTypedContextValue(t *testing.T) {
+	po, baseURL := runPong()
+	root := po.Root
+	userKey := NewKey[_test_util.TestUser]("user")
+	otherKey := NewKey[string]("user")
+	root.Middleware(func(c *Context) {
+		userKey.Set(c, _test_util.TestUser{Name: "吴浩麟"})
+		otherKey.Set(c, "other")
+		c.Set("age", 23)
+	})
+	root.Get("/typed", func(c *Context) {
+		if user, ok := userKey.Get(c); !ok || user.Name != "吴浩麟" {
+			t.Error(user)
+		}
+		if other := otherKey.MustGet(c); other != "other" {
+			t.Error(other)
+		}
+		if c.Value(userKey) == nil {
+			t.Error("Key should can be read by Value")
+		}
+		if age, ok := GetAs[int](c, "age"); !ok || age != 23 {
+			t.Error(age)
+		}
+		if _, ok := GetAs[string](c, "age"); ok {
+			t.Error("type not match should not ok")
+		}
+		if MustGet[int](c, "age") != 23 {
+			t.Error()
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("MustGet should panic when not set")
+				}
+			}()
+			MustGet[int](c, "no-this")
+		}()
+		c.Response.String("")
+		t.Log(`TestTypedContextValue`)
+	})
+	defer http.Get(baseURL + "/typed")
+}
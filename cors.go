@@ -0,0 +1,210 @@
+package pong
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// default methods allowed by CORS when CORSOptions.AllowMethods is empty
+var corsDefaultMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// CORSOptions config Cross-Origin Resource Sharing of a router, set it by Router.CORS
+// an origin is allowed if it match any of AllowOrigins, AllowOriginRegexps or AllowOriginFunc
+type CORSOptions struct {
+	// allowed origins like "https://example.com", "*" allow any origin,
+	// and one * in an origin match any part like "https://*.example.com"
+	AllowOrigins []string
+	// allowed origins match any of the regexps
+	AllowOriginRegexps []*regexp.Regexp
+	// return true if the origin is allowed
+	AllowOriginFunc func(origin string) bool
+	// methods allowed in preflight, default is GET HEAD POST PUT PATCH and DELETE
+	AllowMethods []string
+	// headers allowed in preflight, default allow every header request by Access-Control-Request-Headers
+	AllowHeaders []string
+	// headers browser can read from response other than CORS-safelisted response headers
+	ExposeHeaders []string
+	// whether browser can send cookies and read response of request with credentials
+	// it can't be used with AllowOrigins "*", that would let any site read the user's response, list the allowed origins instead
+	AllowCredentials bool
+	// seconds browser can cache preflight result, 0 means not send Access-Control-Max-Age
+	MaxAge int
+}
+
+// set the CORS config used by every handle register in this router and it's sub routers
+// a sub router can set it's own config to overwrite parent's
+// preflight request of a registered path is answered by pong before any Middleware executes, so it needs no OPTIONS handle and authentication
+// it panic if AllowOrigins has "*" and AllowCredentials is true
+func (r *Router) CORS(options CORSOptions) {
+	o := options
+	if o.AllowCredentials && hasString(o.AllowOrigins, "*") {
+		panic(`pong:CORS AllowOrigins "*" can't be used with AllowCredentials`)
+	}
+	if len(o.AllowMethods) == 0 {
+		o.AllowMethods = corsDefaultMethods
+	}
+	r.cors = &o
+	r.pong.corsEnabled = true
+}
+
+// whether all origins are allowed and response is the same for every origin
+func (options *CORSOptions) anyOrigin() bool {
+	return hasString(options.AllowOrigins, "*")
+}
+
+func (options *CORSOptions) allowOrigin(origin string) bool {
+	for _, allow := range options.AllowOrigins {
+		if allow == "*" || strings.EqualFold(allow, origin) {
+			return true
+		}
+		if star := strings.IndexByte(allow, '*'); star >= 0 {
+			prefix, suffix := allow[:star], allow[star+1:]
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	for _, allow := range options.AllowOriginRegexps {
+		if allow.MatchString(origin) {
+			return true
+		}
+	}
+	return options.AllowOriginFunc != nil && options.AllowOriginFunc(origin)
+}
+
+func (options *CORSOptions) allowMethod(method string) bool {
+	for _, allow := range options.AllowMethods {
+		if strings.EqualFold(allow, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// return headers to send in Access-Control-Allow-Headers, ok is false if any request header is not allowed
+func (options *CORSOptions) allowHeaders(requestHeaders string) (allowed string, ok bool) {
+	if len(options.AllowHeaders) == 0 {
+		return requestHeaders, true
+	}
+	for _, header := range strings.Split(requestHeaders, ",") {
+		header = strings.TrimSpace(header)
+		if len(header) == 0 {
+			continue
+		}
+		found := false
+		for _, allow := range options.AllowHeaders {
+			if strings.EqualFold(allow, header) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return strings.Join(options.AllowHeaders, ", "), true
+}
+
+// add CORS headers to response, if request is a preflight answer it and return true
+func (options *CORSOptions) handle(c *Context, preflight bool) bool {
+	request := c.Request.HTTPRequest
+	header := c.Response.HTTPResponseWriter.Header()
+	origin := request.Header.Get("Origin")
+	anyOrigin := options.anyOrigin()
+	if !anyOrigin {
+		// response is different for different origin, cache must not share it
+		header.Add("Vary", "Origin")
+	}
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		c.Response.StatusCode = http.StatusNoContent
+		defer c.Response.HTTPResponseWriter.WriteHeader(c.Response.StatusCode)
+	}
+	if len(origin) == 0 || !options.allowOrigin(origin) {
+		return preflight
+	}
+	var allowHeaders string
+	if preflight {
+		if !options.allowMethod(request.Header.Get("Access-Control-Request-Method")) {
+			return true
+		}
+		var ok bool
+		if allowHeaders, ok = options.allowHeaders(request.Header.Get("Access-Control-Request-Headers")); !ok {
+			return true
+		}
+	}
+	if anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if options.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		if len(options.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(options.ExposeHeaders, ", "))
+		}
+		return false
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(options.AllowMethods, ", "))
+	if len(allowHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", allowHeaders)
+	}
+	if options.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(options.MaxAge))
+	}
+	return true
+}
+
+// find the handle register to path steps and method, and the CORS config of the router own it
+// it match path like Router.handle but execute nothing
+func (r *Router) route(steps []string, method string) (handle HandleFunc, cors *CORSOptions) {
+	router := r
+	cors = r.cors
+	for len(steps) > 1 {
+		sub := router.subRoutersMap[steps[0]]
+		if sub == nil && len(router.paramName) > 0 {
+			sub = router.subRoutersMap[":"]
+		}
+		if sub == nil {
+			return nil, nil
+		}
+		if sub.cors != nil {
+			cors = sub.cors
+		}
+		router, steps = sub, steps[1:]
+	}
+	handle = router.subHandlesMap[subHandlesMapKey{steps[0], method}]
+	if handle == nil && len(router.paramName) > 0 {
+		handle = router.subHandlesMap[subHandlesMapKey{":", method}]
+	}
+	return handle, cors
+}
+
+// apply CORS config of the router which will handle this request, return true if request is a preflight and has been answered
+// preflight is only answered when path has a handle for the method it request
+func (pong *Pong) handleCORS(steps []string, c *Context) bool {
+	if !pong.corsEnabled {
+		return false
+	}
+	request := c.Request.HTTPRequest
+	method := request.Method
+	requestMethod := request.Header.Get("Access-Control-Request-Method")
+	preflight := method == http.MethodOptions && len(requestMethod) > 0 && len(request.Header.Get("Origin")) > 0
+	if preflight {
+		method = requestMethod
+	}
+	handle, cors := pong.Root.route(steps, method)
+	if handle == nil || cors == nil {
+		return false
+	}
+	return cors.handle(c, preflight)
+}
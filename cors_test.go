@@ -0,0 +1,112 @@
+package pong
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	po, baseURL := runPong()
+	api := po.Root.Router("/api")
+	api.CORS(CORSOptions{
+		AllowOrigins:       []string{"https://example.com", "https://*.example.org"},
+		AllowOriginRegexps: []*regexp.Regexp{regexp.MustCompile(`^http://localhost:\d+$`)},
+		AllowHeaders:       []string{"Content-Type", "Authorization"},
+		ExposeHeaders:      []string{"X-Total"},
+		AllowCredentials:   true,
+		MaxAge:             600,
+	})
+	// auth Middleware should not stop preflight
+	api.Middleware(func(c *Context) {
+		if len(c.Request.HTTPRequest.Header.Get("Authorization")) == 0 {
+			c.Abort(NewHTTPError(http.StatusUnauthorized, ""))
+		}
+	})
+	api.Put("/users/:id", func(c *Context) {
+		c.Response.String(c.Request.Param("id"))
+	})
+	public := api.Router("/public")
+	public.CORS(CORSOptions{AllowOrigins: []string{"*"}})
+	public.Get("/ping", func(c *Context) {
+		c.Response.String("pong")
+	})
+	do := func(method string, path string, header map[string]string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, baseURL+path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	// preflight is answered without OPTIONS handle
+	res := do(http.MethodOptions, "/api/users/1", map[string]string{
+		"Origin":                         "https://a.example.org",
+		"Access-Control-Request-Method":  http.MethodPut,
+		"Access-Control-Request-Headers": "content-type, authorization",
+	})
+	if res.StatusCode != http.StatusNoContent ||
+		res.Header.Get("Access-Control-Allow-Origin") != "https://a.example.org" ||
+		res.Header.Get("Access-Control-Allow-Credentials") != "true" ||
+		res.Header.Get("Access-Control-Allow-Methods") != "GET, HEAD, POST, PUT, PATCH, DELETE" ||
+		res.Header.Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" ||
+		res.Header.Get("Access-Control-Max-Age") != "600" ||
+		res.Header.Values("Vary")[0] != "Origin" {
+		t.Error("preflight", res.StatusCode, res.Header)
+	}
+	// not allowed origin, method or header get no allow headers
+	for _, header := range []map[string]string{
+		{"Origin": "https://evil.com", "Access-Control-Request-Method": http.MethodPut},
+		{"Origin": "https://example.org", "Access-Control-Request-Method": http.MethodPut},
+		{"Origin": "https://example.com", "Access-Control-Request-Method": http.MethodPut, "Access-Control-Request-Headers": "X-Evil"},
+	} {
+		res = do(http.MethodOptions, "/api/users/1", header)
+		if res.StatusCode != http.StatusNoContent || len(res.Header.Get("Access-Control-Allow-Origin")) != 0 {
+			t.Error("preflight should be rejected", header, res.StatusCode, res.Header)
+		}
+	}
+	// preflight of method not registered is handled like other OPTIONS request
+	res = do(http.MethodOptions, "/api/users/1", map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": http.MethodDelete})
+	if res.StatusCode != http.StatusUnauthorized || len(res.Header.Get("Access-Control-Allow-Origin")) != 0 {
+		t.Error("preflight of method not registered should not be answered", res.StatusCode, res.Header)
+	}
+
+	// actual request
+	res = do(http.MethodPut, "/api/users/1", map[string]string{"Origin": "http://localhost:8080", "Authorization": "token"})
+	if res.StatusCode != http.StatusOK ||
+		res.Header.Get("Access-Control-Allow-Origin") != "http://localhost:8080" ||
+		res.Header.Get("Access-Control-Expose-Headers") != "X-Total" ||
+		res.Header.Get("Vary") != "Origin" {
+		t.Error("actual request", res.StatusCode, res.Header)
+	}
+	// error response also has CORS headers, so browser can read it
+	res = do(http.MethodPut, "/api/users/1", map[string]string{"Origin": "https://example.com"})
+	if res.StatusCode != http.StatusUnauthorized || res.Header.Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Error("error response", res.StatusCode, res.Header)
+	}
+	res = do(http.MethodPut, "/api/users/1", map[string]string{"Origin": "https://evil.com", "Authorization": "token"})
+	if len(res.Header.Get("Access-Control-Allow-Origin")) != 0 || res.Header.Get("Vary") != "Origin" {
+		t.Error("not allowed origin", res.Header)
+	}
+
+	// sub router overwrite parent's config, response is the same for every origin so no Vary
+	res = do(http.MethodGet, "/api/public/ping", map[string]string{"Origin": "https://evil.com", "Authorization": "token"})
+	if res.Header.Get("Access-Control-Allow-Origin") != "*" || len(res.Header.Get("Vary")) != 0 {
+		t.Error("public", res.Header)
+	}
+}
+
+func TestCORSAnyOriginWithCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error(`AllowOrigins "*" with AllowCredentials should panic`)
+		}
+	}()
+	New().Root.CORS(CORSOptions{AllowOrigins: []string{"*"}, AllowCredentials: true})
+}
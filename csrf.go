@@ -0,0 +1,249 @@
+package pong
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// default form field name to submit CSRF token, also used as the cookie name in double submit mode
+	CSRFFieldName = "_csrf"
+	// default header name to submit CSRF token, used by XHR and fetch
+	CSRFHeaderName = "X-CSRF-Token"
+	// session value name used to store CSRF token
+	sessionCSRFName = sessionInternalPrefix + "csrf"
+	// bytes of a CSRF token
+	csrfTokenLength = 32
+)
+
+// template funcs provide by pong, they are placeholders when parse templates and bind to request when Render
+var templateFuncs = template.FuncMap{
+	// return CSRF token of current request, empty if CSRF Middleware is not used
+	"csrfToken": func() string {
+		return ""
+	},
+	// return a hidden input with CSRF token for forms, empty if CSRF Middleware is not used
+	"csrfField": func() template.HTML {
+		return ""
+	},
+}
+
+// CSRFOptions config CSRF Middleware, zero value is ready to use
+type CSRFOptions struct {
+	// token is store in session by default, if DoubleSubmit is true or session is not enabled,
+	// token is store in a cookie and request must submit the same token
+	DoubleSubmit bool
+	// cookie's name in double submit mode, default is CSRFFieldName
+	CookieName string
+	// cookie's Secure in double submit mode, set it if site is served by HTTPS
+	Secure bool
+	// form field name to read token from, default is CSRFFieldName
+	FieldName string
+	// header name to read token from, default is CSRFHeaderName
+	HeaderName string
+	// hosts like "app.example.com" allowed to send request other than request's own host, they are matched with Origin and Referer
+	TrustedOrigins []string
+	// paths not checked, a path end with * match every path with the prefix before *, like "/webhook/*"
+	ExemptPaths []string
+	// return true if request should not be checked, like API requests authenticated by token
+	Exempt func(c *Context) bool
+}
+
+func (options *CSRFOptions) withDefault() *CSRFOptions {
+	o := *options
+	if len(o.CookieName) == 0 {
+		o.CookieName = CSRFFieldName
+	}
+	if len(o.FieldName) == 0 {
+		o.FieldName = CSRFFieldName
+	}
+	if len(o.HeaderName) == 0 {
+		o.HeaderName = CSRFHeaderName
+	}
+	return &o
+}
+
+// Context key used to store CSRFOptions of CSRF Middleware handle this request
+type csrfKey struct{}
+
+// Context key used to store token made in this request
+type csrfSecretKey struct{}
+
+// make a Middleware protect unsafe requests from CSRF, use it after EnableSession so token can be store in session
+// safe methods GET HEAD OPTIONS and TRACE are not checked, other requests must submit token by form field or header,
+// and their Origin or Referer must be request's own host or in TrustedOrigins if they are send
+// request fail to pass is stopped and ErrorCSRFOrigin or ErrorCSRFToken is give to HTTPErrorHandle, default response with code 403
+// read token by Context.CSRFToken, or by template funcs csrfToken and csrfField in templates
+//
+//	<form method="post">{{ csrfField }}</form>
+func CSRF(options ...CSRFOptions) HandleFunc {
+	o := (&CSRFOptions{}).withDefault()
+	if len(options) > 0 {
+		o = options[0].withDefault()
+	}
+	return func(c *Context) {
+		c.store(csrfKey{}, o)
+		c.templateFuncs = template.FuncMap{
+			"csrfToken": c.CSRFToken,
+			"csrfField": func() template.HTML {
+				return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(o.FieldName) +
+					`" value="` + template.HTMLEscapeString(c.CSRFToken()) + `">`)
+			},
+		}
+		switch c.Request.HTTPRequest.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			return
+		}
+		if o.exempt(c) {
+			return
+		}
+		if !o.trustedOrigin(c.Request.HTTPRequest) {
+			c.Abort(ErrorCSRFOrigin)
+		}
+		expected := c.csrfSecret(o)
+		submitted := unmaskCSRFToken(o.submittedToken(c.Request.HTTPRequest))
+		if expected == nil || subtle.ConstantTimeCompare(expected, submitted) != 1 {
+			c.Abort(ErrorCSRFToken)
+		}
+	}
+}
+
+func (options *CSRFOptions) exempt(c *Context) bool {
+	path := c.Request.HTTPRequest.URL.Path
+	for _, exempt := range options.ExemptPaths {
+		if strings.HasSuffix(exempt, "*") {
+			if strings.HasPrefix(path, exempt[:len(exempt)-1]) {
+				return true
+			}
+		} else if path == exempt {
+			return true
+		}
+	}
+	return options.Exempt != nil && options.Exempt(c)
+}
+
+// check Origin, or Referer if there is no Origin
+// request send by non-browser client may have neither, it's allowed and still protected by token
+func (options *CSRFOptions) trustedOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if len(origin) == 0 {
+		origin = request.Referer()
+		if len(origin) == 0 {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil || len(u.Host) == 0 {
+		// Origin is "null" for sandboxed iframes and privacy sensitive redirects
+		return false
+	}
+	if strings.EqualFold(u.Host, request.Host) {
+		return true
+	}
+	for _, trusted := range options.TrustedOrigins {
+		if strings.EqualFold(u.Host, trusted) {
+			return true
+		}
+	}
+	return false
+}
+
+// token submitted by header first, then form field
+func (options *CSRFOptions) submittedToken(request *http.Request) string {
+	if token := request.Header.Get(options.HeaderName); len(token) > 0 {
+		return token
+	}
+	return request.PostFormValue(options.FieldName)
+}
+
+// whether token is store in session for this request
+func (c *Context) csrfInSession(options *CSRFOptions) bool {
+	return !options.DoubleSubmit && c.Session != nil
+}
+
+// return the token store in session or cookie, nil if there is no token yet
+func (c *Context) csrfSecret(options *CSRFOptions) []byte {
+	if secret, has := c.load(csrfSecretKey{}); has {
+		return secret.([]byte)
+	}
+	var encoded string
+	if c.csrfInSession(options) {
+		encoded = c.Session.GetString(sessionCSRFName, "")
+	} else if cookie, err := c.Request.HTTPRequest.Cookie(options.CookieName); err == nil {
+		encoded = cookie.Value
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(secret) != csrfTokenLength {
+		return nil
+	}
+	return secret
+}
+
+// return the CSRF token to put in form field or header, a new token is made and store if there is no token yet
+// every call return a different string because token is masked by a one-time pad to prevent BREACH attack, all of them are valid
+// return empty string if CSRF Middleware is not used
+func (c *Context) CSRFToken() string {
+	value, has := c.load(csrfKey{})
+	if !has {
+		return ""
+	}
+	options := value.(*CSRFOptions)
+	secret := c.csrfSecret(options)
+	if secret == nil {
+		secret = make([]byte, csrfTokenLength)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+		encoded := base64.RawURLEncoding.EncodeToString(secret)
+		if c.csrfInSession(options) {
+			c.Session.Put(sessionCSRFName, encoded)
+		} else {
+			c.Response.Cookie(&http.Cookie{
+				Name:     options.CookieName,
+				Value:    encoded,
+				Path:     "/",
+				Secure:   options.Secure,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		// later call in this request should get the same token
+		c.store(csrfSecretKey{}, secret)
+	}
+	return maskCSRFToken(secret)
+}
+
+// masked token is pad + (pad xor secret)
+func maskCSRFToken(secret []byte) string {
+	masked := make([]byte, 2*len(secret))
+	if _, err := rand.Read(masked[:len(secret)]); err != nil {
+		panic(err)
+	}
+	for i, b := range secret {
+		masked[len(secret)+i] = masked[i] ^ b
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// return secret in a masked token, token not masked like the cookie value read by JavaScript is also accepted
+func unmaskCSRFToken(token string) []byte {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil
+	}
+	switch len(decoded) {
+	case csrfTokenLength:
+		return decoded
+	case 2 * csrfTokenLength:
+		secret := make([]byte, csrfTokenLength)
+		for i := range secret {
+			secret[i] = decoded[i] ^ decoded[csrfTokenLength+i]
+		}
+		return secret
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package pong
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// a SessionStore keep sessions in map, only used to test Middlewares need session
+type mapSessionStore struct {
+	failSessionStore
+	lock     sync.Mutex
+	lastId   int
+	sessions map[string]map[string]interface{}
+}
+
+func (s *mapSessionStore) NewSession(ctx context.Context) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastId++
+	sessionId := strconv.Itoa(s.lastId)
+	s.sessions[sessionId] = make(map[string]interface{})
+	return sessionId, nil
+}
+
+func (s *mapSessionStore) Read(ctx context.Context, sessionId string) (map[string]interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session, has := s.sessions[sessionId]
+	if !has {
+		return nil, nil
+	}
+	wholeValue := make(map[string]interface{}, len(session))
+	for k, v := range session {
+		wholeValue[k] = v
+	}
+	return wholeValue, nil
+}
+
+func (s *mapSessionStore) Write(ctx context.Context, sessionId string, changes map[string]interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for k, v := range changes {
+		s.sessions[sessionId][k] = v
+	}
+	return nil
+}
+
+// a http.Client keep cookies, every client is a different visitor
+func newCookieClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar}
+}
+
+// send a request with header and form, return response's status code and body
+func csrfRequest(t *testing.T, client *http.Client, method string, target string, header map[string]string, form url.Values) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, target, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set(httpHeaderContentType, applicationForm)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return res.StatusCode, string(bs)
+}
+
+func TestCSRF(t *testing.T) {
+	po, baseURL := runPong()
+	po.EnableSessionStore(&mapSessionStore{sessions: make(map[string]map[string]interface{})})
+	po.Root.Middleware(CSRF(CSRFOptions{
+		TrustedOrigins: []string{"app.example.com"},
+		ExemptPaths:    []string{"/hook/*"},
+	}))
+	if err := po.ParseTemplateGlob("_test/html/*.html"); err != nil {
+		t.Fatal(err)
+	}
+	po.Root.Get("/form", func(c *Context) {
+		c.Response.Render("form.html", nil)
+	})
+	po.Root.Get("/token", func(c *Context) {
+		c.Response.String(c.CSRFToken())
+	})
+	po.Root.Post("/submit", func(c *Context) {
+		c.Response.String("ok")
+	})
+	po.Root.Post("/hook/github", func(c *Context) {
+		c.Response.String("ok")
+	})
+	client := newCookieClient()
+	_, form := csrfRequest(t, client, http.MethodGet, baseURL+"/form", nil, nil)
+	prefix := `<form method="post"><input type="hidden" name="_csrf" value="`
+	if !strings.HasPrefix(form, prefix) {
+		t.Fatal("csrfField should render a hidden input", form)
+	}
+	token := strings.TrimSuffix(strings.TrimPrefix(form, prefix), `"></form>`)
+	if _, other := csrfRequest(t, client, http.MethodGet, baseURL+"/token", nil, nil); other == token {
+		t.Error("token should be masked differently every time")
+	}
+
+	assert := func(client *http.Client, path string, header map[string]string, form url.Values, code int, body string) {
+		t.Helper()
+		if c, b := csrfRequest(t, client, http.MethodPost, baseURL+path, header, form); c != code || (len(body) > 0 && b != body) {
+			t.Error(path, header, form, c, b)
+		}
+	}
+	assert(client, "/submit", nil, nil, http.StatusForbidden, ErrorCSRFToken.Error())
+	assert(client, "/submit", nil, url.Values{"_csrf": {"bad"}}, http.StatusForbidden, "")
+	assert(client, "/submit", nil, url.Values{"_csrf": {token}}, http.StatusOK, "ok")
+	assert(client, "/submit", map[string]string{CSRFHeaderName: token}, nil, http.StatusOK, "ok")
+	assert(client, "/submit", map[string]string{CSRFHeaderName: token, "Origin": baseURL}, nil, http.StatusOK, "ok")
+	assert(client, "/submit", map[string]string{CSRFHeaderName: token, "Origin": "https://app.example.com"}, nil, http.StatusOK, "ok")
+	assert(client, "/submit", map[string]string{CSRFHeaderName: token, "Origin": "https://evil.com"}, nil, http.StatusForbidden, ErrorCSRFOrigin.Error())
+	assert(client, "/submit", map[string]string{CSRFHeaderName: token, "Referer": "https://evil.com/page"}, nil, http.StatusForbidden, "")
+	assert(client, "/submit", map[string]string{CSRFHeaderName: token, "Origin": "null"}, nil, http.StatusForbidden, "")
+	// token of a session can't be used by another session
+	assert(newCookieClient(), "/submit", map[string]string{CSRFHeaderName: token}, nil, http.StatusForbidden, "")
+	// exempt path
+	assert(newCookieClient(), "/hook/github", nil, nil, http.StatusOK, "ok")
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	po, baseURL := runPong()
+	po.Root.Middleware(CSRF(CSRFOptions{DoubleSubmit: true}))
+	po.Root.Get("/token", func(c *Context) {
+		c.Response.String(c.CSRFToken())
+	})
+	po.Root.Post("/submit", func(c *Context) {
+		c.Response.String("ok")
+	})
+	client := newCookieClient()
+	cookie := func() string {
+		u, _ := url.Parse(baseURL)
+		for _, cookie := range client.Jar.Cookies(u) {
+			if cookie.Name == CSRFFieldName {
+				return cookie.Value
+			}
+		}
+		return ""
+	}
+	_, token := csrfRequest(t, client, http.MethodGet, baseURL+"/token", nil, nil)
+	value := cookie()
+	if len(value) == 0 || len(token) == 0 {
+		t.Fatal("token should be store in cookie")
+	}
+	// token is keep in later requests
+	csrfRequest(t, client, http.MethodGet, baseURL+"/token", nil, nil)
+	if cookie() != value {
+		t.Error("token should not change")
+	}
+	if code, body := csrfRequest(t, client, http.MethodPost, baseURL+"/submit", map[string]string{CSRFHeaderName: token}, nil); code != http.StatusOK || body != "ok" {
+		t.Error(code, body)
+	}
+	// JavaScript can submit the cookie value
+	if code, body := csrfRequest(t, client, http.MethodPost, baseURL+"/submit", map[string]string{CSRFHeaderName: value}, nil); code != http.StatusOK || body != "ok" {
+		t.Error(code, body)
+	}
+	if code, _ := csrfRequest(t, newCookieClient(), http.MethodPost, baseURL+"/submit", map[string]string{CSRFHeaderName: token}, nil); code != http.StatusForbidden {
+		t.Error(code)
+	}
+}
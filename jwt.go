@@ -0,0 +1,244 @@
+package pong
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// every error return by VerifyJWT wrap it, use errors.Is to check
+var ErrorInvalidJWT = errors.New("invalid JWT")
+
+// JWTOptions config JWT Middleware and VerifyJWT
+type JWTOptions struct {
+	// keys to verify token's signature by token's kid, rotate keys by adding a new kid before signing with it
+	// a token without kid is verified by key with empty kid
+	// key's type decide the only algorithm it accept: []byte for HS256, *rsa.PublicKey for RS256 and *ecdsa.PublicKey on P-256 for ES256
+	Keys map[string]interface{}
+	// if it's not empty, token's iss must be it
+	Issuer string
+	// if it's not empty, token's aud must contain it
+	Audience string
+	// allowed clock skew when check exp and nbf
+	Leeway time.Duration
+	// read token from this cookie if request has no `Authorization: Bearer <token>`, empty means token is not read from cookie
+	Cookie string
+}
+
+// make a Middleware authenticate request by JWT in `Authorization: Bearer <token>`
+// request fail to pass is stopped and ErrorUnauthorized is give to HTTPErrorHandle with WWW-Authenticate header
+// the authenticated Principal is set to Context by PrincipalKey, it's Subject is token's sub,
+// Roles is claim roles, Scopes is claim scope split by space and Claims is all claims
+func JWT(options JWTOptions) HandleFunc {
+	return func(c *Context) {
+		request := c.Request.HTTPRequest
+		token := bearerToken(request)
+		if len(token) == 0 && len(options.Cookie) > 0 {
+			if cookie, err := request.Cookie(options.Cookie); err == nil {
+				token = cookie.Value
+			}
+		}
+		if len(token) == 0 {
+			c.unauthorized("Bearer")
+		}
+		claims, err := VerifyJWT(token, options)
+		if err != nil {
+			c.unauthorized(`Bearer error="invalid_token"`)
+		}
+		principal := &Principal{Scheme: "jwt", Claims: claims}
+		principal.Subject, _ = claims["sub"].(string)
+		if roles, ok := claims["roles"].([]interface{}); ok {
+			for _, role := range roles {
+				if role, ok := role.(string); ok {
+					principal.Roles = append(principal.Roles, role)
+				}
+			}
+		}
+		if scope, ok := claims["scope"].(string); ok {
+			principal.Scopes = strings.Fields(scope)
+		}
+		PrincipalKey.Set(c, principal)
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+func jwtError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrorInvalidJWT, fmt.Sprintf(format, args...))
+}
+
+// verify token's signature and claims exp nbf iss and aud, return it's claims
+// numbers in claims are float64 like json.Unmarshal
+func VerifyJWT(token string, options JWTOptions) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, jwtError("malformed token")
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, jwtError("malformed header")
+	}
+	var header jwtHeader
+	if err = json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, jwtError("malformed header")
+	}
+	key, has := options.Keys[header.Kid]
+	if !has {
+		return nil, jwtError("unknown kid %q", header.Kid)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, jwtError("malformed signature")
+	}
+	if err = jwtVerify(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, jwtError("malformed payload")
+	}
+	var claims map[string]interface{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, jwtError("malformed payload")
+	}
+	now := time.Now()
+	if exp, has := claims["exp"]; has {
+		exp, ok := exp.(float64)
+		if !ok || now.After(time.Unix(int64(exp), 0).Add(options.Leeway)) {
+			return nil, jwtError("token is expired")
+		}
+	}
+	if nbf, has := claims["nbf"]; has {
+		nbf, ok := nbf.(float64)
+		if !ok || now.Before(time.Unix(int64(nbf), 0).Add(-options.Leeway)) {
+			return nil, jwtError("token is not valid yet")
+		}
+	}
+	if len(options.Issuer) > 0 && claims["iss"] != options.Issuer {
+		return nil, jwtError("issuer is not %q", options.Issuer)
+	}
+	if len(options.Audience) > 0 && !jwtHasAudience(claims["aud"], options.Audience) {
+		return nil, jwtError("audience is not %q", options.Audience)
+	}
+	return claims, nil
+}
+
+// aud can be a string or an array of string
+func jwtHasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verify signature, algorithm must be the one key's type accept so a token can't choose a weaker one
+func jwtVerify(alg string, key interface{}, signed []byte, signature []byte) error {
+	digest := sha256.Sum256(signed)
+	switch key := key.(type) {
+	case []byte:
+		if alg != "HS256" {
+			break
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return jwtError("signature is invalid")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return jwtError("signature is invalid")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || key.Curve != elliptic.P256() {
+			break
+		}
+		if len(signature) != 64 {
+			return jwtError("signature is invalid")
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return jwtError("signature is invalid")
+		}
+		return nil
+	default:
+		return jwtError("key type %T is not supported", key)
+	}
+	return jwtError("algorithm %q is not allowed for key %T", alg, key)
+}
+
+// make a JWT with claims, sign it by key and set kid in header if it's not empty
+// key's type decide the algorithm: []byte for HS256, *rsa.PrivateKey for RS256 and *ecdsa.PrivateKey on P-256 for ES256
+func SignJWT(claims map[string]interface{}, kid string, key interface{}) (string, error) {
+	header := jwtHeader{Typ: "JWT", Kid: kid}
+	switch key.(type) {
+	case []byte:
+		header.Alg = "HS256"
+	case *rsa.PrivateKey:
+		header.Alg = "RS256"
+	case *ecdsa.PrivateKey:
+		header.Alg = "ES256"
+	default:
+		return "", fmt.Errorf("pong:key type %T is not supported", key)
+	}
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(headerBytes) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return "", errors.New("pong:ES256 key must be on P-256")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return "", err
+		}
+		// r and s are padded to 32 bytes each
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
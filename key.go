@@ -0,0 +1,84 @@
+package pong
+
+import "fmt"
+
+// typedKey is implemented by every Key[T], used to find Key in Context.Value
+type typedKey interface {
+	typedKeyName() string
+}
+
+// Key is a typed key to store value in Context
+// two Key never collide even if they have the same name, so middlewares can use there own Key without worry about others
+//
+// for example:
+//
+//	var UserKey = pong.NewKey[*User]("user")
+//	UserKey.Set(c, user)
+//	user, ok := UserKey.Get(c)
+type Key[T any] struct {
+	name string
+}
+
+// make a new Key, name is just used to describe this Key in error message
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) typedKeyName() string {
+	return k.name
+}
+
+// return the Key's name
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// set a value to Context with this Key
+func (k *Key[T]) Set(c *Context, value T) {
+	c.store(k, value)
+}
+
+// get the value set by Key.Set
+// if the value is not set, a zero value and false will return
+func (k *Key[T]) Get(c *Context) (value T, ok bool) {
+	v, has := c.load(k)
+	if !has {
+		return
+	}
+	value, ok = v.(T)
+	return
+}
+
+// get the value set by Key.Set, if value is not set MustGet will panic
+func (k *Key[T]) MustGet(c *Context) T {
+	value, ok := k.Get(c)
+	if !ok {
+		panic(fmt.Sprintf("pong:key %q not set in context", k.name))
+	}
+	return value
+}
+
+// get a value set by Context.Set and assert it's type is T
+// if the value is not set or type is not T, a zero value and false will return
+func GetAs[T any](c *Context, name string) (value T, ok bool) {
+	v, has := c.load(name)
+	if !has {
+		return
+	}
+	value, ok = v.(T)
+	return
+}
+
+// get a value set by Context.Set and assert it's type is T
+// if the value is not set or type is not T, MustGet will panic with a clear message
+func MustGet[T any](c *Context, name string) T {
+	v, has := c.load(name)
+	if !has {
+		panic(fmt.Sprintf("pong:%q not set in context", name))
+	}
+	value, ok := v.(T)
+	if !ok {
+		panic(fmt.Sprintf("pong:%q in context is %T not %T", name, v, value))
+	}
+	return value
+}
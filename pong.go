@@ -7,7 +7,6 @@ Example:
 
     import (
     	"github.com/gwuhaolin/pong"
-    	"net/http"
     	"log"
     )
 
@@ -30,8 +29,8 @@ Example:
     		c.Response.JSON(m)
     	})
 
-    	// Run Server Listen on 127.0.0.1:3000
-    	log.Println(http.ListenAndServe(":3000", po))
+    	// Run Server Listen on 127.0.0.1:3000, shutdown gracefully on SIGINT or SIGTERM
+    	log.Println(po.Run(":3000"))
     }
 
 Learn more at https://github.com/gwuhaolin/pong
@@ -43,24 +42,79 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 var (
-	// SessionId's Cookies name store in browser
+	// default SessionId's Cookies name store in browser, used when SessionOptions.CookieName is empty
 	SessionCookiesName = "SESSIONID"
 	// this error will be return when use bind in request when bind data to struct fail
 	ErrorTypeNotSupport = errors.New("type not support")
+	// this error will be give to HTTPErrorHandle when a handle can't finish in timeout set by Router.Timeout or pong.Timeout
+	// default HTTPErrorHandle will response it with code 503
+	ErrorHandleTimeout = NewHTTPError(http.StatusServiceUnavailable, "handle timeout")
+	// this error will be give to HTTPErrorHandle when request is canceled before a handle with timeout finish, like client has gone
+	// client can't see the response, default HTTPErrorHandle response it with code 499 so it can be logged like nginx
+	ErrorRequestCanceled = NewHTTPError(499, "request canceled")
+	// this error will be return when a SessionIO can't make a new session, it's NewSession return empty sessionId
+	ErrorNewSession = errors.New("session manager can't make a new session")
+	// this error will be give to HTTPErrorHandle when session's lock can't be acquired in SessionOptions.LockTimeout
+	// default HTTPErrorHandle will response it with code 503
+	ErrorSessionLockTimeout = NewHTTPError(http.StatusServiceUnavailable, "session lock timeout")
+	// this error will be give to HTTPErrorHandle when CSRF Middleware find request's Origin or Referer is not trusted
+	// default HTTPErrorHandle will response it with code 403
+	ErrorCSRFOrigin = NewHTTPError(http.StatusForbidden, "cross origin request is not allowed")
+	// this error will be give to HTTPErrorHandle when CSRF Middleware find request's CSRF token is missing or invalid
+	// default HTTPErrorHandle will response it with code 403
+	ErrorCSRFToken = NewHTTPError(http.StatusForbidden, "invalid CSRF token")
+	// this error will be give to HTTPErrorHandle when BasicAuth APIKeyAuth or JWT Middleware can't authenticate request
+	// default HTTPErrorHandle will response it with code 401
+	ErrorUnauthorized = NewHTTPError(http.StatusUnauthorized, "")
+	// this error will be give to HTTPErrorHandle when Authorizer refuse a Principal to access a route
+	// default HTTPErrorHandle will response it with code 403
+	ErrorForbidden = NewHTTPError(http.StatusForbidden, "")
+	// this error will be give to HTTPErrorHandle when RateLimit Middleware find a client send too many requests
+	// default HTTPErrorHandle will response it with code 429
+	ErrorTooManyRequests = NewHTTPError(http.StatusTooManyRequests, "")
 )
 
+// HTTPError is an error with HTTP status code
+// when HTTPErrorHandle is default, pong will response with it's StatusCode and Message
+type HTTPError struct {
+	// HTTP status code response to client
+	StatusCode int
+	// message response to client
+	Message string
+}
+
+// make a HTTPError, if message is empty will use http.StatusText(statusCode)
+func NewHTTPError(statusCode int, message string) *HTTPError {
+	if len(message) == 0 {
+		message = http.StatusText(statusCode)
+	}
+	return &HTTPError{
+		StatusCode: statusCode,
+		Message:    message,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
 type (
 	// HandleFunc is a handle in Middleware list, like a machine production line to do some change
 	// used to read something from request and store by Context.Request
 	// make a response to client by Context.Response
 	HandleFunc func(*Context)
 	Pong       struct {
-		htmlTemplate       *template.Template
+		htmlTemplate *template.Template
+		// a copy of htmlTemplate never executed, Render clone it when request has it's own template funcs
+		templateSource     *template.Template
 		tailMiddlewareList []HandleFunc
+		afterResponseList  []HandleFunc
 		// Root router to path /
 		Root *Router
 		// 404 not find handle
@@ -69,10 +123,32 @@ type (
 		NotFindHandle   HandleFunc
 		// when send response to client cause error happen, pong will use HTTPErrorHandle to handle this request
 		// default is response with code 500, and string inter server error
+		// if the error is a *HTTPError default will response with it's StatusCode
 		HTTPErrorHandle func(error, *Context)
-		// SessionManager used to store and update value in session when pong has EnableSession
-		// default SessionManager store data in memory
-		sessionManager  SessionIO
+		// check permissions required by Router.Require and Router.RequireRoute, default is RoleAuthorizer
+		Authorizer Authorizer
+		// sessionStore used to store and update value in session when pong has EnableSession or EnableSessionStore
+		sessionStore    SessionStore
+		sessionOptions  *SessionOptions
+		sessionCookieIO SessionCookieIO
+		sessionLocker   SessionLocker
+		sessionAdmin    SessionAdmin
+		sessionTouches  *sessionTouches
+		// whether any router has CORS config
+		corsEnabled bool
+		// Server used by Run RunTLS RunUnix and RunListener, pong will set itself as it's Handler
+		// default has ReadHeaderTimeout ReadTimeout WriteTimeout and IdleTimeout, change it before Run
+		Server *http.Server
+		// max time to wait running requests finish when shutdown, after that connections will be closed
+		// default is 10 seconds
+		ShutdownTimeout time.Duration
+		// time to wait before stop accepting new request when shutdown
+		// in this time Ready() return false, so load balancer's health check can find this server is draining
+		// default is 0
+		ShutdownDelay  time.Duration
+		onStartList    []func()
+		onShutdownList []func()
+		notReady       int32
 	}
 )
 
@@ -89,8 +165,20 @@ func New() *Pong {
 		},
 		HTTPErrorHandle: func(err error, c *Context) {
 			c.Response.StatusCode = http.StatusInternalServerError
+			var httpError *HTTPError
+			if errors.As(err, &httpError) {
+				c.Response.StatusCode = httpError.StatusCode
+			}
 			c.Response.String(err.Error())
 		},
+		Server: &http.Server{
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		},
+		ShutdownTimeout: 10 * time.Second,
+		Authorizer:      RoleAuthorizer{},
 	}
 	pong.Root = newRouter(pong)
 	return pong
@@ -100,6 +188,35 @@ func New() *Pong {
 func (pong *Pong) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	steps := splitPath(request.URL.Path)
 	context := newContext(pong, writer, request)
+	// Session's lock must be released even the handle panic or timeout
+	defer func() {
+		if !context.sessionDetached {
+			releaseSession(context)
+		}
+	}()
+	pong.handle(steps, context)
+	context.sender().Response.finish()
+}
+
+// handle request by Root router
+// if the handle is stopped by Context.Abort, like SessionStore fail to load session, the error is give to HTTPErrorHandle
+func (pong *Pong) handle(steps []string, context *Context) {
+	defer func() {
+		if p := recover(); p != nil {
+			abort, ok := p.(*handleAbort)
+			if !ok {
+				panic(p)
+			}
+			// Context.Abort in BeforeSend handles and TailMiddleware is handle by responseWriter
+			c := context.sender()
+			if abort.err != nil && !c.Response.Committed() {
+				pong.HTTPErrorHandle(abort.err, c)
+			}
+		}
+	}()
+	if pong.handleCORS(steps, context) {
+		return
+	}
 	pong.Root.handle(steps, context)
 }
 
@@ -110,17 +227,50 @@ func (pong *Pong) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 // returned template will have the (base) name and (parsed) contents of the
 // first file matched by the pattern. LoadTemplateGlob is equivalent to calling
 // ParseFiles with the list of files matched by the pattern.
+// template funcs provide by pong like csrfToken and csrfField can be used in templates
+// if files can't be load or parse, template load before is keep, use ParseTemplateGlob to get the error
 func (pong *Pong) LoadTemplateGlob(path string) {
-	htmlTemplate, err := template.ParseGlob(path)
+	pong.ParseTemplateGlob(path)
+}
+
+// works like LoadTemplateGlob, but return the error if files can't be load or parse
+func (pong *Pong) ParseTemplateGlob(path string) error {
+	files, err := filepath.Glob(path)
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("pattern matches no files: %#q", path)
+	}
 	if err != nil {
-		fmt.Errorf("pong:%v", err)
+		return fmt.Errorf("pong:%v", err)
 	}
-	pong.htmlTemplate = htmlTemplate
+	htmlTemplate, err := template.New(filepath.Base(files[0])).Funcs(templateFuncs).ParseFiles(files...)
+	if err != nil {
+		return fmt.Errorf("pong:%v", err)
+	}
+	templateSource, err := htmlTemplate.Clone()
+	if err != nil {
+		return fmt.Errorf("pong:%v", err)
+	}
+	pong.htmlTemplate, pong.templateSource = htmlTemplate, templateSource
+	return nil
+}
+
+// return HTML template load by LoadTemplateGlob, if not load return nil
+func (pong *Pong) HTMLTemplate() *template.Template {
+	return pong.htmlTemplate
 }
 
 // add a middleware in the process's tail.
 // which will execute before response data to client and after all of the other middleware register in router
+// it execute just before HTTP headers are send, no matter the response is send by JSON String File Redirect or write to HTTPResponseWriter directly,
+// and if a handle send nothing it will still execute before pong send an empty response with Response.StatusCode
 // if you add more than one middlewares,this middlewares will execute in order
 func (pong *Pong) TailMiddleware(middlewareList ...HandleFunc) {
 	pong.tailMiddlewareList = append(pong.tailMiddlewareList, middlewareList...)
 }
+
+// add a handle which will execute after response has send to client
+// in this time Response.StatusCode and Response.Size() is what client receive, it's a good place to write access log
+// if you add more than one handles,this handles will execute in order
+func (pong *Pong) AfterResponse(handles ...HandleFunc) {
+	pong.afterResponseList = append(pong.afterResponseList, handles...)
+}
@@ -3,29 +3,28 @@ package pong
 import (
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
-	"fmt"
-	"strconv"
-	"github.com/gwuhaolin/pong/_test"
 )
 
+// servers started by runPong, they are closed after all tests finish
+var testServers []*httptest.Server
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	for _, server := range testServers {
+		server.Close()
+	}
+	os.Exit(code)
+}
+
+// runPong serve po by a httptest.Server which listen on a random local port
 func runPong() (po *Pong, baseURL string) {
 	po = New()
-	po.Root.Middleware(func(c *Context) {
-		req := c.Request.HTTPRequest
-		fmt.Println(req.Method, req.Host, req.RequestURI)
-	})
-	serverHasRun := make(chan bool)
-	go func() {
-		listenAddr := "127.0.0.1:" + strconv.Itoa(_test_util.ListenPort)
-		baseURL = "http://" + listenAddr
-		serverHasRun <- true
-		fmt.Println("server listen on:" + listenAddr)
-		http.ListenAndServe(listenAddr, po)
-	}()
-	<-serverHasRun
-	_test_util.ListenPort++
-	return
+	server := httptest.NewServer(po)
+	testServers = append(testServers, server)
+	return po, server.URL
 }
 
 func TestHTTPErrorHandle(t *testing.T) {
@@ -65,7 +64,16 @@ func TestHTTPErrorHandle(t *testing.T) {
 func TestLoadTemplateGlobError(t *testing.T) {
 	po, baseURL := runPong()
 	po.LoadTemplateGlob("/no/this/file/")
-	po.LoadTemplateGlob("_test/html/*.html")
+	if err := po.ParseTemplateGlob("/no/this/file/"); err == nil {
+		t.Error("ParseTemplateGlob should fail if no file match")
+	}
+	if err := po.ParseTemplateGlob("_test/html/*.html"); err != nil {
+		t.Error(err)
+	}
+	// template load before is keep
+	if err := po.ParseTemplateGlob("/no/this/file/"); err == nil || po.HTMLTemplate() == nil {
+		t.Error("template load before should be keep", err)
+	}
 	po.Root.Get("/render", func(c *Context) {
 		c.Response.Render("/no/this/file.html", nil)
 	})
@@ -73,3 +81,22 @@ func TestLoadTemplateGlobError(t *testing.T) {
 		http.Get(baseURL + "/render")
 	}()
 }
+
+func TestHTTPErrorStatusCode(t *testing.T) {
+	po, baseURL := runPong()
+	po.Root.Get("/forbidden", func(c *Context) {
+		po.HTTPErrorHandle(NewHTTPError(http.StatusForbidden, ""), c)
+	})
+	defer func() {
+		res, err := http.Get(baseURL + "/forbidden")
+		if err != nil {
+			t.Error(err)
+		} else {
+			bs, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != http.StatusForbidden || string(bs) != http.StatusText(http.StatusForbidden) {
+				t.Error(res.StatusCode, string(bs))
+			}
+		}
+	}()
+}
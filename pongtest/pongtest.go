@@ -0,0 +1,325 @@
+/*
+pongtest drive a *pong.Pong in process by net/http/httptest, no real port is listened.
+
+Example:
+
+	func TestHi(t *testing.T) {
+		po := pong.New()
+		po.Root.Post("/hi", func(c *pong.Context) {
+			c.Response.JSON(map[string]string{"name": c.Request.Form("name")})
+		})
+		client := pongtest.New(t, po)
+		client.Post("/hi").Form(url.Values{"name": {"hal"}}).Do().
+			AssertStatus(http.StatusOK).
+			AssertJSON(map[string]string{"name": "hal"})
+	}
+*/
+package pongtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gwuhaolin/pong"
+)
+
+// Client send request to a *pong.Pong in process
+// it keep cookies between requests like a browser, so session works
+type Client struct {
+	t    testing.TB
+	pong *pong.Pong
+	// cookie jar used to store cookies send by pong and send them back in next request
+	Jar http.CookieJar
+	// every request's URL is BaseURL + path, default is http://example.com
+	// use a https URL to make Secure cookies be send back
+	BaseURL string
+}
+
+// make a Client to send request to po
+func New(t testing.TB, po *pong.Pong) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		t:       t,
+		pong:    po,
+		Jar:     jar,
+		BaseURL: "http://example.com",
+	}
+}
+
+// make a Request with method and path, path can include query string
+func (client *Client) NewRequest(method string, path string) *Request {
+	return &Request{
+		client: client,
+		method: method,
+		path:   path,
+		header: make(http.Header),
+		query:  make(url.Values),
+	}
+}
+
+// make a GET Request
+func (client *Client) Get(path string) *Request {
+	return client.NewRequest(http.MethodGet, path)
+}
+
+// make a HEAD Request
+func (client *Client) Head(path string) *Request {
+	return client.NewRequest(http.MethodHead, path)
+}
+
+// make a POST Request
+func (client *Client) Post(path string) *Request {
+	return client.NewRequest(http.MethodPost, path)
+}
+
+// make a PUT Request
+func (client *Client) Put(path string) *Request {
+	return client.NewRequest(http.MethodPut, path)
+}
+
+// make a PATCH Request
+func (client *Client) Patch(path string) *Request {
+	return client.NewRequest(http.MethodPatch, path)
+}
+
+// make a DELETE Request
+func (client *Client) Delete(path string) *Request {
+	return client.NewRequest(http.MethodDelete, path)
+}
+
+// make a OPTIONS Request
+func (client *Client) Options(path string) *Request {
+	return client.NewRequest(http.MethodOptions, path)
+}
+
+// return cookie store in Client's Jar by name, if not find return nil
+func (client *Client) Cookie(name string) *http.Cookie {
+	u, _ := url.Parse(client.BaseURL)
+	for _, cookie := range client.Jar.Cookies(u) {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// Request is a builder to make a HTTP request, call Do to send it
+type Request struct {
+	client  *Client
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	body    []byte
+}
+
+// set a HTTP Header
+func (r *Request) Header(name string, value string) *Request {
+	r.header.Set(name, value)
+	return r
+}
+
+// add a query param to URL
+func (r *Request) Query(name string, value string) *Request {
+	r.query.Add(name, value)
+	return r
+}
+
+// add a Cookie, it's send with cookies in Client's Jar
+func (r *Request) Cookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// set request body and Content-Type
+func (r *Request) Body(contentType string, body io.Reader) *Request {
+	bs, err := ioutil.ReadAll(body)
+	if err != nil {
+		r.client.t.Fatalf("pongtest:read body fail:%v", err)
+	}
+	r.body = bs
+	r.header.Set("Content-Type", contentType)
+	return r
+}
+
+// set request body to data encode by json.Marshal
+func (r *Request) JSON(data interface{}) *Request {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		r.client.t.Fatalf("pongtest:json.Marshal fail:%v", err)
+	}
+	return r.Body("application/json;charset=utf-8", bytes.NewReader(bs))
+}
+
+// set request body to an application/x-www-form-urlencoded form
+func (r *Request) Form(values url.Values) *Request {
+	return r.Body("application/x-www-form-urlencoded", strings.NewReader(values.Encode()))
+}
+
+// send request to pong and return the Response
+// cookies set by pong will be store in Client's Jar
+func (r *Request) Do() *Response {
+	client := r.client
+	target, err := url.Parse(client.BaseURL + r.path)
+	if err != nil {
+		client.t.Fatalf("pongtest:bad path %q:%v", r.path, err)
+	}
+	if len(r.query) > 0 {
+		query := target.Query()
+		for name, values := range r.query {
+			for _, value := range values {
+				query.Add(name, value)
+			}
+		}
+		target.RawQuery = query.Encode()
+	}
+	request := httptest.NewRequest(r.method, target.String(), bytes.NewReader(r.body))
+	for name, values := range r.header {
+		request.Header[name] = values
+	}
+	for _, cookie := range client.Jar.Cookies(target) {
+		request.AddCookie(cookie)
+	}
+	for _, cookie := range r.cookies {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	client.pong.ServeHTTP(recorder, request)
+	response := recorder.Result()
+	client.Jar.SetCookies(target, response.Cookies())
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	return &Response{
+		t:        client.t,
+		pong:     client.pong,
+		Response: response,
+		Body:     body,
+	}
+}
+
+// Response is what pong response to a Request, has some assertion helpers
+// every assertion call t.Errorf when fail and return the Response so can be chained
+type Response struct {
+	t    testing.TB
+	pong *pong.Pong
+	// the response, it's Body has been read to Response.Body
+	*http.Response
+	// response body
+	Body []byte
+}
+
+// return response body as string
+func (res *Response) String() string {
+	return string(res.Body)
+}
+
+// return cookie in response by name, if not find return nil
+func (res *Response) Cookie(name string) *http.Cookie {
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// parse response body as JSON and bind to pointer
+func (res *Response) BindJSON(pointer interface{}) error {
+	return json.Unmarshal(res.Body, pointer)
+}
+
+// assert response status code
+func (res *Response) AssertStatus(code int) *Response {
+	res.t.Helper()
+	if res.StatusCode != code {
+		res.t.Errorf("pongtest:status code is %d, want %d, body:%s", res.StatusCode, code, res.Body)
+	}
+	return res
+}
+
+// assert response HTTP Header's value
+func (res *Response) AssertHeader(name string, value string) *Response {
+	res.t.Helper()
+	if got := res.Header.Get(name); got != value {
+		res.t.Errorf("pongtest:header %s is %q, want %q", name, got, value)
+	}
+	return res
+}
+
+// assert response has set a cookie with name and value
+func (res *Response) AssertCookie(name string, value string) *Response {
+	res.t.Helper()
+	cookie := res.Cookie(name)
+	if cookie == nil {
+		res.t.Errorf("pongtest:cookie %s not set", name)
+	} else if cookie.Value != value {
+		res.t.Errorf("pongtest:cookie %s is %q, want %q", name, cookie.Value, value)
+	}
+	return res
+}
+
+// assert response body equal to body
+func (res *Response) AssertBody(body string) *Response {
+	res.t.Helper()
+	if string(res.Body) != body {
+		res.t.Errorf("pongtest:body is %q, want %q", res.Body, body)
+	}
+	return res
+}
+
+// assert response body contains substr
+func (res *Response) AssertContains(substr string) *Response {
+	res.t.Helper()
+	if !strings.Contains(string(res.Body), substr) {
+		res.t.Errorf("pongtest:body %q not contains %q", res.Body, substr)
+	}
+	return res
+}
+
+// assert response body is a JSON equal to expected
+// expected is encode by json.Marshal and then compare with response body,so field order and space not matter
+func (res *Response) AssertJSON(expected interface{}) *Response {
+	res.t.Helper()
+	expectedBytes, err := json.Marshal(expected)
+	if err != nil {
+		res.t.Fatalf("pongtest:json.Marshal fail:%v", err)
+	}
+	var want, got interface{}
+	json.Unmarshal(expectedBytes, &want)
+	if err := json.Unmarshal(res.Body, &got); err != nil {
+		res.t.Errorf("pongtest:body %q is not JSON:%v", res.Body, err)
+		return res
+	}
+	if !reflect.DeepEqual(want, got) {
+		res.t.Errorf("pongtest:JSON body is %s, want %s", res.Body, expectedBytes)
+	}
+	return res
+}
+
+// assert response body is the HTML template name render by data
+// pong must LoadTemplateGlob before
+func (res *Response) AssertRender(name string, data interface{}) *Response {
+	res.t.Helper()
+	tpl := res.pong.HTMLTemplate()
+	if tpl == nil {
+		res.t.Fatalf("pongtest:LoadTemplateGlob before AssertRender")
+	}
+	html := bytes.Buffer{}
+	if err := tpl.ExecuteTemplate(&html, name, data); err != nil {
+		res.t.Fatalf("pongtest:render template %s fail:%v", name, err)
+	}
+	if html.String() != string(res.Body) {
+		res.t.Errorf("pongtest:body is %q, want template %s render %q", res.Body, name, html.String())
+	}
+	return res
+}
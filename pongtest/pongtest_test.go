@@ -0,0 +1,79 @@
+package pongtest
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/_test"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	po := pong.New()
+	po.Root.Post("/user/:name", func(c *pong.Context) {
+		user := _test_util.TestUser{}
+		if err := c.Request.BindJSON(&user); err != nil {
+			t.Error(err)
+		}
+		cookie, _ := c.Request.HTTPRequest.Cookie("id")
+		c.Response.Header("X-name", c.Request.Param("name"))
+		c.Response.Header("X-header", c.Request.HTTPRequest.Header.Get("X-header"))
+		c.Response.Header("X-cookie", cookie.Value)
+		c.Response.Header("X-query", c.Request.Query("q"))
+		c.Response.StatusCode = http.StatusCreated
+		c.Response.JSON(user)
+	})
+	po.Root.Post("/form", func(c *pong.Context) {
+		c.Response.String(c.Request.Form("name"))
+	})
+	client := New(t, po)
+	user := _test_util.TestUser{Name: "吴浩麟", Age: 23}
+	client.Post("/user/hal").
+		Query("q", "pong").
+		Header("X-header", "header").
+		Cookie(&http.Cookie{Name: "id", Value: "123"}).
+		JSON(user).
+		Do().
+		AssertStatus(http.StatusCreated).
+		AssertHeader("X-name", "hal").
+		AssertHeader("X-header", "header").
+		AssertHeader("X-cookie", "123").
+		AssertHeader("X-query", "pong").
+		AssertJSON(user)
+	client.Post("/form").Form(url.Values{"name": {"hal"}}).Do().AssertBody("hal")
+	client.Get("/no/this").Do().AssertStatus(http.StatusNotFound).AssertBody(_test_util.NotFindString)
+}
+
+func TestCookieJar(t *testing.T) {
+	po := pong.New()
+	po.Root.Get("/login", func(c *pong.Context) {
+		c.Response.Cookie(&http.Cookie{Name: "user", Value: "hal", Path: "/"})
+		c.Response.String("login")
+	})
+	po.Root.Get("/me", func(c *pong.Context) {
+		cookie, err := c.Request.HTTPRequest.Cookie("user")
+		if err != nil {
+			c.Response.StatusCode = http.StatusUnauthorized
+			c.Response.String("")
+			return
+		}
+		c.Response.String(cookie.Value)
+	})
+	client := New(t, po)
+	client.Get("/me").Do().AssertStatus(http.StatusUnauthorized)
+	client.Get("/login").Do().AssertCookie("user", "hal")
+	client.Get("/me").Do().AssertStatus(http.StatusOK).AssertBody("hal")
+	if client.Cookie("user") == nil {
+		t.Error("cookie should store in jar")
+	}
+}
+
+func TestAssertRender(t *testing.T) {
+	po := pong.New()
+	po.LoadTemplateGlob("../_test/html/*.html")
+	po.Root.Get("/render", func(c *pong.Context) {
+		c.Response.Render("index.html", "中文")
+	})
+	New(t, po).Get("/render").Do().AssertRender("index.html", "中文").AssertContains("中文")
+}
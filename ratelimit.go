@@ -0,0 +1,188 @@
+package pong
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitResult is the state of a client's bucket after it take a token
+type RateLimitResult struct {
+	// whether the request is allowed
+	Allowed bool
+	// requests allowed in a window, it's also the max burst
+	Limit int
+	// requests still allowed now
+	Remaining int
+	// time until the bucket is full again
+	Reset time.Duration
+	// time to wait before next request will be allowed, 0 if Allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keep every client's bucket of RateLimit Middleware
+// NewMemoryRateLimitStore keep buckets in process, implement it by a shared backend like redis to limit across processes
+type RateLimitStore interface {
+	// take a token from key's bucket which hold limit tokens and refill limit tokens evenly every window
+	Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStore keep buckets in memory by GCRA, a token bucket algorithm only store one time for each key
+// buckets which have been full are evicted, so memory is only used by active clients
+type MemoryRateLimitStore struct {
+	lock sync.Mutex
+	// theoretical arrival time of next request of each key, bucket is full if it's before now
+	buckets   map[string]time.Time
+	lastSweep time.Time
+	// how often full buckets are evicted
+	sweepInterval time.Duration
+	now           func() time.Time
+}
+
+// make a MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:       make(map[string]time.Time),
+		sweepInterval: time.Minute,
+		now:           time.Now,
+	}
+}
+
+func (store *MemoryRateLimitStore) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	now := store.now()
+	if now.Sub(store.lastSweep) >= store.sweepInterval {
+		store.sweep(now)
+	}
+	result, tat := gcra(store.buckets[key], now, limit, window)
+	if result.Allowed {
+		store.buckets[key] = tat
+	}
+	return result, nil
+}
+
+// remove full buckets, a full bucket is the same as a bucket not exist
+func (store *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, tat := range store.buckets {
+		if !tat.After(now) {
+			delete(store.buckets, key)
+		}
+	}
+	store.lastSweep = now
+}
+
+// return how many buckets are kept
+func (store *MemoryRateLimitStore) Len() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return len(store.buckets)
+}
+
+// take a token from bucket by GCRA, tat is the theoretical arrival time store for the bucket
+// return the result and the new tat to store if request is allowed
+func gcra(tat time.Time, now time.Time, limit int, window time.Duration) (RateLimitResult, time.Time) {
+	interval := window / time.Duration(limit)
+	// Limit larger than Window in nanoseconds, allow one request every nanosecond
+	if interval <= 0 {
+		interval = 1
+	}
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(interval)
+	result := RateLimitResult{Limit: limit}
+	if allowAt := newTat.Add(-window); now.Before(allowAt) {
+		result.RetryAfter = allowAt.Sub(now)
+		result.Reset = tat.Sub(now)
+		return result, tat
+	}
+	result.Allowed = true
+	result.Reset = newTat.Sub(now)
+	result.Remaining = int((window - result.Reset) / interval)
+	return result, newTat
+}
+
+// RateLimitOptions config RateLimit Middleware
+type RateLimitOptions struct {
+	// requests allowed in Window for a client, it's also the max burst
+	Limit  int
+	Window time.Duration
+	// return the key to identify a client, default is RateLimitByIP
+	// return empty string means the request is not limited
+	Key func(c *Context) string
+	// where buckets are kept, default is a new MemoryRateLimitStore for this Middleware
+	Store RateLimitStore
+	// prefix of key in Store, set it to separate limiters share a Store like "login"
+	Name string
+}
+
+// make a Middleware limit how many requests a client can send, by a token bucket which refill Limit tokens every Window
+// RateLimit-Limit RateLimit-Remaining RateLimit-Reset and RateLimit-Policy headers are send in every response,
+// request over limit is stopped with Retry-After header, and ErrorTooManyRequests is give to HTTPErrorHandle, default response with code 429
+func RateLimit(options RateLimitOptions) HandleFunc {
+	o := options
+	if o.Limit <= 0 {
+		o.Limit = 1
+	}
+	if o.Window <= 0 {
+		o.Window = time.Second
+	}
+	if o.Key == nil {
+		o.Key = RateLimitByIP
+	}
+	if o.Store == nil {
+		o.Store = NewMemoryRateLimitStore()
+	}
+	policy := strconv.Itoa(o.Limit) + ";w=" + strconv.Itoa(ceilSeconds(o.Window))
+	return func(c *Context) {
+		key := o.Key(c)
+		if len(key) == 0 {
+			return
+		}
+		result, err := o.Store.Take(c, o.Name+":"+key, o.Limit, o.Window)
+		if err != nil {
+			c.Abort(err)
+		}
+		header := c.Response.HTTPResponseWriter.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		header.Set("RateLimit-Policy", policy)
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.Abort(ErrorTooManyRequests)
+		}
+	}
+}
+
+// header value in seconds are rounded up, so client never retry too early
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// limit requests by client's IP, it's the host of request's RemoteAddr
+func RateLimitByIP(c *Context) string {
+	return "ip:" + clientIP(c.Request.HTTPRequest)
+}
+
+// limit requests by sessionId, request without session is limited by client's IP
+func RateLimitBySession(c *Context) string {
+	if c.Session != nil {
+		if id := c.Session.ID(); len(id) > 0 {
+			return "session:" + id
+		}
+	}
+	return RateLimitByIP(c)
+}
+
+// limit requests by authenticated Principal's Subject, request not authenticated is limited by client's IP
+// use it after authentication Middleware
+func RateLimitByUser(c *Context) string {
+	if principal := c.Principal(); principal != nil {
+		return "user:" + principal.Scheme + ":" + principal.Subject
+	}
+	return RateLimitByIP(c)
+}
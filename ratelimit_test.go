@@ -0,0 +1,108 @@
+package pong
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	po, baseURL := runPong()
+	store := NewMemoryRateLimitStore()
+	var nowLock sync.Mutex
+	now := time.Now()
+	store.now = func() time.Time {
+		nowLock.Lock()
+		defer nowLock.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		nowLock.Lock()
+		now = now.Add(d)
+		nowLock.Unlock()
+	}
+	api := po.Root.Router("/api")
+	api.Middleware(RateLimit(RateLimitOptions{
+		Limit:  2,
+		Window: time.Second,
+		Store:  store,
+		Name:   "login",
+		Key: func(c *Context) string {
+			return c.Request.HTTPRequest.Header.Get("X-Client")
+		},
+	}))
+	api.Post("/login", func(c *Context) {
+		c.Response.String("ok")
+	})
+	do := func(client string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, baseURL+"/api/login", nil)
+		req.Header.Set("X-Client", client)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+	assert := func(res *http.Response, code int, remaining string, reset string, retryAfter string) {
+		t.Helper()
+		if res.StatusCode != code ||
+			res.Header.Get("RateLimit-Limit") != "2" ||
+			res.Header.Get("RateLimit-Remaining") != remaining ||
+			res.Header.Get("RateLimit-Reset") != reset ||
+			res.Header.Get("RateLimit-Policy") != "2;w=1" ||
+			res.Header.Get("Retry-After") != retryAfter {
+			t.Error(res.StatusCode, res.Header)
+		}
+	}
+	assert(do("a"), http.StatusOK, "1", "1", "")
+	assert(do("a"), http.StatusOK, "0", "1", "")
+	assert(do("a"), http.StatusTooManyRequests, "0", "1", "1")
+	// other client has it's own bucket
+	assert(do("b"), http.StatusOK, "1", "1", "")
+	// a token is refilled every Window/Limit
+	advance(500 * time.Millisecond)
+	assert(do("a"), http.StatusOK, "0", "1", "")
+	assert(do("a"), http.StatusTooManyRequests, "0", "1", "1")
+	// request with empty key is not limited
+	if res := do(""); res.StatusCode != http.StatusOK || len(res.Header.Get("RateLimit-Limit")) != 0 {
+		t.Error(res.StatusCode, res.Header)
+	}
+
+	// full buckets are evicted
+	if store.Len() != 2 {
+		t.Error(store.Len())
+	}
+	advance(2 * time.Minute)
+	do("c")
+	if store.Len() != 1 {
+		t.Error("full buckets should be evicted", store.Len())
+	}
+}
+
+func TestRateLimitLimitOverWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Now()
+	store.now = func() time.Time {
+		return now
+	}
+	// Window/Limit is less than a nanosecond
+	result, err := store.Take(context.Background(), "a", 100, 10*time.Nanosecond)
+	if err != nil || !result.Allowed || result.Remaining != 9 {
+		t.Error(result, err)
+	}
+	po := New()
+	po.Root.Middleware(RateLimit(RateLimitOptions{Limit: 100, Window: 10 * time.Nanosecond}))
+	po.Root.Get("/", func(c *Context) {
+		c.Response.String("ok")
+	})
+	recorder := httptest.NewRecorder()
+	po.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Error(recorder.Code)
+	}
+}
@@ -1,10 +1,13 @@
 package pong
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 )
 
@@ -32,13 +35,150 @@ const (
 
 // is used by an HTTP handler to response to client's request.
 type Response struct {
-	context *Context
+	context        *Context
+	writer         *responseWriter
+	beforeSendList []HandleFunc
+	afterSendList  []HandleFunc
 	// point to http.ResponseWriter in golang's standard lib
+	// pong wrap it so everything write to it will run BeforeSend handles and TailMiddleware first
 	HTTPResponseWriter http.ResponseWriter
 	// HTTP status code response to client
 	StatusCode int
 }
 
+// responseWriter wrap http.ResponseWriter in golang's standard lib
+// it run Response's BeforeSend handles and pong's TailMiddleware just before HTTP headers are committed,
+// and record status and body size for AfterSend handles
+type responseWriter struct {
+	http.ResponseWriter
+	response  *Response
+	committed bool
+	hijacked  bool
+	size      int
+	// failed is true if response has been replaced by error because a BeforeSend handle or TailMiddleware call Context.Abort
+	failed bool
+	// discard is true if what the handle write should be dropped after response has been replaced by error
+	discard bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.committed || w.hijacked {
+		return
+	}
+	w.committed = true
+	res := w.response
+	res.StatusCode = code
+	err := runHandles(res.context, res.beforeSendList, res.context.pong.tailMiddlewareList)
+	// BeforeSend handles run only once, even the response is replaced by error below
+	res.beforeSendList = nil
+	if err != nil && !w.failed {
+		// a handle call Context.Abort, send the error instead of what has been write
+		w.failed = true
+		w.committed = false
+		res.context.pong.HTTPErrorHandle(err, res.context)
+		if !w.committed {
+			w.WriteHeader(res.StatusCode)
+		}
+		w.discard = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(res.StatusCode)
+}
+
+// run handle lists in order, if a handle call Context.Abort the rest are skipped and the abort error is return
+func runHandles(c *Context, lists ...[]HandleFunc) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			abort, ok := p.(*handleAbort)
+			if !ok {
+				panic(p)
+			}
+			err = abort.err
+		}
+	}()
+	for _, list := range lists {
+		for _, handle := range list {
+			handle(c)
+		}
+	}
+	return nil
+}
+
+func (w *responseWriter) Write(bs []byte) (int, error) {
+	if !w.committed {
+		w.WriteHeader(w.response.StatusCode)
+	}
+	if w.discard {
+		// response has been replaced by error, drop what the handle write
+		return len(bs), nil
+	}
+	n, err := w.ResponseWriter.Write(bs)
+	w.size += n
+	return n, err
+}
+
+// Flush implement http.Flusher if the wrapped http.ResponseWriter support it
+func (w *responseWriter) Flush() {
+	if !w.committed {
+		w.WriteHeader(w.response.StatusCode)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implement http.Hijacker if the wrapped http.ResponseWriter support it
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("pong:http.ResponseWriter not support Hijack")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap return the wrapped http.ResponseWriter, used by http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish commit the response if nobody has write it, then run AfterSend handles and pong's AfterResponse handles
+func (res *Response) finish() {
+	if !res.writer.committed && !res.writer.hijacked {
+		res.writer.WriteHeader(res.StatusCode)
+	}
+	// response has been send, Context.Abort in AfterSend handles can only stop the rest of them
+	runHandles(res.context, res.afterSendList, res.context.pong.afterResponseList)
+}
+
+// add handles which will execute just before this response's HTTP headers are send to client
+// no matter the response is send by JSON String File Redirect or write to HTTPResponseWriter directly
+// handles can still change Response.StatusCode Header and Cookie,they execute before pong's TailMiddleware
+// if a handle call Context.Abort, the error is give to HTTPErrorHandle and what the running handle write is dropped
+func (res *Response) BeforeSend(handles ...HandleFunc) {
+	res.beforeSendList = append(res.beforeSendList, handles...)
+}
+
+// add handles which will execute after this response's body has send to client
+// in this time Response.StatusCode and Response.Size() is what client receive
+func (res *Response) AfterSend(handles ...HandleFunc) {
+	res.afterSendList = append(res.afterSendList, handles...)
+}
+
+// return whether HTTP headers has been send to client
+// after committed Header Cookie and StatusCode can't change any more
+func (res *Response) Committed() bool {
+	return res.writer.committed
+}
+
+// return how many bytes of body has been send to client
+func (res *Response) Size() int {
+	return res.writer.size
+}
+
 // write a HTTP Header to response
 //
 // use before response has send to client
@@ -55,9 +195,6 @@ func (res *Response) Cookie(cookie *http.Cookie) {
 
 func (res *Response) sendData(contentType string, bs []byte) {
 	res.HTTPResponseWriter.Header().Set(httpHeaderContentType, contentType)
-	for _, handle := range res.context.pong.tailMiddlewareList {
-		handle(res.context)
-	}
 	res.HTTPResponseWriter.WriteHeader(res.StatusCode)
 	res.HTTPResponseWriter.Write(bs)
 }
@@ -140,6 +277,12 @@ func (res *Response) HTML(html string) {
 func (res *Response) Render(template string, data interface{}) {
 	tpl := res.context.pong.htmlTemplate
 	if tpl != nil {
+		// bind template funcs to this request, like csrfToken
+		if source := res.context.pong.templateSource; source != nil && len(res.context.templateFuncs) > 0 {
+			if clone, err := source.Clone(); err == nil {
+				tpl = clone.Funcs(res.context.templateFuncs)
+			}
+		}
 		html := bytes.Buffer{}
 		err := tpl.ExecuteTemplate(&html, template, data)
 		if err != nil {
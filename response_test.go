@@ -310,3 +310,121 @@ func TestRedirect(t *testing.T) {
 		}
 	}()
 }
+
+func TestTailMiddlewareEveryResponse(t *testing.T) {
+	po, baseURL := runPong()
+	root := po.Root
+	po.TailMiddleware(func(c *Context) {
+		c.Response.Header("X-Tail", "tail")
+	})
+	root.Get("/file", func(c *Context) {
+		c.Response.File("_test/html/index.html")
+	})
+	root.Get("/redirect", func(c *Context) {
+		c.Response.StatusCode = http.StatusFound
+		c.Response.Redirect("/file")
+	})
+	root.Get("/raw", func(c *Context) {
+		c.Response.HTTPResponseWriter.Write([]byte("raw"))
+	})
+	root.Get("/empty", func(c *Context) {
+	})
+	defer func() {
+		client := http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		for _, path := range [...]string{"/file", "/redirect", "/raw", "/empty"} {
+			res, err := client.Get(baseURL + path)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			res.Body.Close()
+			if res.Header.Get("X-Tail") != "tail" {
+				t.Error(path, res.Header)
+			}
+		}
+		t.Log(`TestTailMiddlewareEveryResponse`)
+	}()
+}
+
+func TestAfterResponse(t *testing.T) {
+	po, baseURL := runPong()
+	root := po.Root
+	bodyStr := "hello,乓"
+	done := make(chan bool, 1)
+	po.AfterResponse(func(c *Context) {
+		if !c.Response.Committed() {
+			t.Error("response should has committed")
+		}
+		if c.Response.StatusCode != http.StatusAccepted || c.Response.Size() != len(bodyStr) {
+			t.Error(c.Response.StatusCode, c.Response.Size())
+		}
+		done <- true
+	})
+	root.Get("/hi", func(c *Context) {
+		c.Response.BeforeSend(func(c *Context) {
+			c.Response.StatusCode = http.StatusAccepted
+		})
+		c.Response.String(bodyStr)
+	})
+	defer func() {
+		res, err := http.Get(baseURL + "/hi")
+		if err != nil {
+			t.Error(err)
+		} else {
+			res.Body.Close()
+			if res.StatusCode != http.StatusAccepted {
+				t.Error(res.StatusCode)
+			}
+			<-done
+		}
+		t.Log(`TestAfterResponse`)
+	}()
+}
+
+func TestAbortBeforeSend(t *testing.T) {
+	po, baseURL := runPong()
+	root := po.Root
+	po.TailMiddleware(func(c *Context) {
+		if c.Request.HTTPRequest.Header.Get("X-Tail-Abort") != "" {
+			c.Abort(NewHTTPError(http.StatusForbidden, "tail"))
+		}
+	})
+	root.Get("/before", func(c *Context) {
+		c.Response.BeforeSend(func(c *Context) {
+			c.Abort(NewHTTPError(http.StatusConflict, "before"))
+		})
+		c.Response.String("handle")
+	})
+	root.Get("/tail", func(c *Context) {
+		c.Response.String("handle")
+	})
+	cases := []struct {
+		path   string
+		header string
+		code   int
+		body   string
+	}{
+		{"/before", "", http.StatusConflict, "before"},
+		{"/tail", "1", http.StatusForbidden, "tail"},
+		{"/tail", "", http.StatusOK, "handle"},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, baseURL+c.path, nil)
+		if len(c.header) > 0 {
+			req.Header.Set("X-Tail-Abort", c.header)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != c.code || string(bs) != c.body {
+			t.Error(c.path, res.StatusCode, string(bs))
+		}
+	}
+}
@@ -3,6 +3,7 @@ package pong
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type subHandlesMapKey struct {
@@ -16,6 +17,14 @@ type Router struct {
 	middlewareList []HandleFunc
 	subRoutersMap  map[string]*Router
 	subHandlesMap  map[subHandlesMapKey]HandleFunc
+	timeout        time.Duration
+	// SessionTransport set by Router.SessionTransport
+	sessionTransport SessionTransport
+	// CORS config set by Router.CORS
+	cors *CORSOptions
+	// permissions set by Router.Require and Router.RequireRoute
+	required      []string
+	routeRequired map[subHandlesMapKey][]string
 }
 
 func newRouter(pong *Pong) *Router {
@@ -155,6 +164,16 @@ func (r *Router) Any(path string, handle HandleFunc) {
 }
 
 func (r *Router) handle(steps []string, context *Context) {
+	// negative timeout overwrite parent's to disable timeout
+	if r.timeout != 0 {
+		context.timeout = r.timeout
+	}
+	if r.sessionTransport != nil {
+		context.sessionTransport = r.sessionTransport
+	}
+	if len(r.required) > 0 {
+		context.required = append(context.required[:len(context.required):len(context.required)], r.required...)
+	}
 	for _, handle := range r.middlewareList {
 		handle(context)
 	}
@@ -176,7 +195,12 @@ func (r *Router) handle(steps []string, context *Context) {
 			handle = r.subHandlesMap[handleKey]
 		}
 		if handle != nil {
-			handle(context)
+			context.authorize(append(context.required[:len(context.required):len(context.required)], r.routeRequired[handleKey]...))
+			if context.timeout > 0 {
+				context.runWithTimeout(context.timeout, handle)
+			} else {
+				handle(context)
+			}
 			return
 		}
 	} else {
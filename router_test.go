@@ -1,40 +1,32 @@
 package pong
 
 import (
-	"io/ioutil"
 	"net/http"
-	"net/url"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"github.com/gwuhaolin/pong/_test"
 )
 
-func httpGetAssert(path string, responseStr string, t *testing.T) {
-	res, err := http.Get(path)
-	if err != nil {
-		t.Error(err)
+// serve a request to po in process and return the recorded response
+func serve(po *Pong, method string, path string, contentType string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(contentType) > 0 {
+		req.Header.Set(httpHeaderContentType, contentType)
 	}
-	bs, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		t.Error(err)
-	}
-	result := string(bs)
-	if result != responseStr {
+	recorder := httptest.NewRecorder()
+	po.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func httpGetAssert(po *Pong, path string, responseStr string, t *testing.T) {
+	if result := serve(po, http.MethodGet, path, "", "").Body.String(); result != responseStr {
 		t.Error(result, responseStr)
 	}
 }
 
-func httpPostAssert(path string, contentType, bodyStr string, responseStr string, t *testing.T) {
-	res, err := http.Post(path, contentType, strings.NewReader(responseStr))
-	if err != nil {
-		t.Error(err)
-	}
-	bs, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		t.Error(err)
-	}
-	result := string(bs)
-	if result != responseStr {
+func httpPostAssert(po *Pong, path string, contentType, bodyStr string, responseStr string, t *testing.T) {
+	if result := serve(po, http.MethodPost, path, contentType, bodyStr).Body.String(); result != responseStr {
 		t.Error(result, responseStr)
 	}
 }
@@ -58,7 +50,7 @@ func TestSplitPath(t *testing.T) {
 }
 
 func TestRouter(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	root := po.Root
 	root.Get("", func(c *Context) {
 		c.Response.String("")
@@ -66,108 +58,109 @@ func TestRouter(t *testing.T) {
 	root.Get("/", func(c *Context) {
 		c.Response.String("/")
 	})
-	defer httpGetAssert(baseURL + "", "/", t)
-	defer httpGetAssert(baseURL + "/", "/", t)
+	// absolute-form request like `GET http://example.com HTTP/1.1` has an empty path
+	defer httpGetAssert(po, "http://example.com", "/", t)
+	defer httpGetAssert(po, "/", "/", t)
 	root.Post("/", func(c *Context) {
 		c.Response.String("POST /")
 	})
-	defer httpPostAssert(baseURL + "/", applicationForm, "", "POST /", t)
+	defer httpPostAssert(po, "/", applicationForm, "", "POST /", t)
 
 	root.Get("/hi", func(c *Context) {
 		c.Response.String("/hi")
 	})
-	defer httpGetAssert(baseURL + "/hi", "/hi", t)
+	defer httpGetAssert(po, "/hi", "/hi", t)
 
 	root.Post("/hi", func(c *Context) {
 		c.Response.String("POST /hi")
 	})
-	defer httpPostAssert(baseURL + "/hi", applicationForm, "", "POST /hi", t)
+	defer httpPostAssert(po, "/hi", applicationForm, "", "POST /hi", t)
 
 	root.Get("/query", func(c *Context) {
 		c.Response.String("/query?name=" + c.Request.Query("name"))
 	})
-	defer httpGetAssert(baseURL + "/query", "/query?name=", t)
-	defer httpGetAssert(baseURL + "/query?name=吴浩麟", "/query?name=吴浩麟", t)
+	defer httpGetAssert(po, "/query", "/query?name=", t)
+	defer httpGetAssert(po, "/query?name=吴浩麟", "/query?name=吴浩麟", t)
 
 	root.Any("/any", func(c *Context) {
 		c.Response.String("/any")
 	})
-	defer httpGetAssert(baseURL + "/any", "/any", t)
-	defer httpPostAssert(baseURL + "/any", applicationForm, "", "/any", t)
+	defer httpGetAssert(po, "/any", "/any", t)
+	defer httpPostAssert(po, "/any", applicationForm, "", "/any", t)
 
 	root.Get("/:param", func(c *Context) {
 		c.Response.String("/:" + c.Request.Param("param"))
 	})
-	defer httpGetAssert(baseURL + "/a", "/:a", t)
+	defer httpGetAssert(po, "/a", "/:a", t)
 
 	root.Get("/param/:id", func(c *Context) {
 		c.Response.String("/param/:" + c.Request.Param("id"))
 	})
-	defer httpGetAssert(baseURL + "/param/123", "/param/:123", t)
+	defer httpGetAssert(po, "/param/123", "/param/:123", t)
 
 	root.Get("/param/a/:id", func(c *Context) {
 		c.Response.String("/param/a/:" + c.Request.Param("id"))
 	})
-	defer httpGetAssert(baseURL + "/param/a/123", "/param/a/:123", t)
+	defer httpGetAssert(po, "/param/a/123", "/param/a/:123", t)
 
 	root.Get("/user/:id/update/:data", func(c *Context) {
 		c.Response.String("/user/" + c.Request.Param("id") + "/update/" + c.Request.Param("data"))
 	})
-	defer httpGetAssert(baseURL + "/user/123/update/{age:24}", "/user/123/update/{age:24}", t)
+	defer httpGetAssert(po, "/user/123/update/{age:24}", "/user/123/update/{age:24}", t)
 
 	root.Get("/note/:id/update/:data", func(c *Context) {
 		c.Response.String("/note/" + c.Request.Param("id") + "/update/" + c.Request.Param("data"))
 	})
-	defer httpGetAssert(baseURL + "/note/123/update/{age:24}", "/note/123/update/{age:24}", t)
+	defer httpGetAssert(po, "/note/123/update/{age:24}", "/note/123/update/{age:24}", t)
 
 	root.Get("/note/:id/remove", func(c *Context) {
 		c.Response.String("/note/" + c.Request.Param("id") + "/remove")
 	})
-	defer httpGetAssert(baseURL + "/note/123/remove", "/note/123/remove", t)
+	defer httpGetAssert(po, "/note/123/remove", "/note/123/remove", t)
 
 	sub := root.Router("/sub")
 
 	sub.Get("/hi", func(c *Context) {
 		c.Response.String("/sub/hi")
 	})
-	defer httpGetAssert(baseURL + "/sub/hi", "/sub/hi", t)
+	defer httpGetAssert(po, "/sub/hi", "/sub/hi", t)
 
 	sub.Get("/note/:param", func(c *Context) {
 		c.Response.String("/sub/note/:" + c.Request.Param("param"))
 	})
-	defer httpGetAssert(baseURL + "/sub/note/a", "/sub/note/:a", t)
+	defer httpGetAssert(po, "/sub/note/a", "/sub/note/:a", t)
 
 	sub2 := sub.Router("/sub2")
 	sub2.Get("", func(c *Context) {
 		c.Response.String("/sub/sub2")
 	})
-	defer httpGetAssert(baseURL + "/sub/sub2", _test_util.NotFindString, t)
+	defer httpGetAssert(po, "/sub/sub2", _test_util.NotFindString, t)
 
 	sub2.Get("/", func(c *Context) {
 		c.Response.String("/sub/sub2/")
 	})
-	defer httpGetAssert(baseURL + "/sub/sub2/", _test_util.NotFindString, t)
+	defer httpGetAssert(po, "/sub/sub2/", _test_util.NotFindString, t)
 
 	sub2.Get("/hi", func(c *Context) {
 		c.Response.String("/sub/sub2/hi")
 	})
-	defer httpGetAssert(baseURL + "/sub/sub2/hi", "/sub/sub2/hi", t)
+	defer httpGetAssert(po, "/sub/sub2/hi", "/sub/sub2/hi", t)
 
 	sub2.Post("/:param/hi", func(c *Context) {
 		c.Response.String("POST /sub/sub2/:" + c.Request.Param("param"))
 	})
-	defer httpPostAssert(baseURL + "/sub/sub2/中文/hi", applicationForm, "", "POST /sub/sub2/:中文", t)
+	defer httpPostAssert(po, "/sub/sub2/中文/hi", applicationForm, "", "POST /sub/sub2/:中文", t)
 
 	sub2.Any("/user/any", func(c *Context) {
 		c.Response.String("/sub/sub2/user/any")
 	})
-	defer httpGetAssert(baseURL + "/sub/sub2/user/any", "/sub/sub2/user/any", t)
-	defer httpPostAssert(baseURL + "/sub/sub2/user/any", applicationForm, "", "/sub/sub2/user/any", t)
+	defer httpGetAssert(po, "/sub/sub2/user/any", "/sub/sub2/user/any", t)
+	defer httpPostAssert(po, "/sub/sub2/user/any", applicationForm, "", "/sub/sub2/user/any", t)
 }
 
 // /:name conflict with /path, but use /path first
 func TestRouterConflict_Handle_PathOverParam(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	root := po.Root
 	root.Get("/path", func(c *Context) {
 		c.Response.String("path")
@@ -175,13 +168,13 @@ func TestRouterConflict_Handle_PathOverParam(t *testing.T) {
 	root.Get("/:name", func(c *Context) {
 		c.Response.String(c.Request.Param("name"))
 	})
-	defer httpGetAssert(baseURL + "/path", "path", t)
-	defer httpGetAssert(baseURL + "/hal", "hal", t)
+	defer httpGetAssert(po, "/path", "path", t)
+	defer httpGetAssert(po, "/hal", "hal", t)
 }
 
 // /:name conflict with /path, but use /path first
 func TestRouterConflict_Handle_ParamOverParam(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	root := po.Root
 	root.Get("/:path", func(c *Context) {
 		c.Response.String("path=" + c.Request.Param("path"))
@@ -189,11 +182,11 @@ func TestRouterConflict_Handle_ParamOverParam(t *testing.T) {
 	root.Get("/:name", func(c *Context) {
 		c.Response.String("name=" + c.Request.Param("name"))
 	})
-	defer httpGetAssert(baseURL + "/abc", "name=abc", t)
+	defer httpGetAssert(po, "/abc", "name=abc", t)
 }
 
 func TestRouterMW(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	root := po.Root
 	c := root.Router("a/b/c")
 	c.Get("hi", func(c *Context) {
@@ -207,11 +200,11 @@ func TestRouterMW(t *testing.T) {
 	b.Middleware(func(c *Context) {
 		c.Response.String("b")
 	})
-	defer httpGetAssert(baseURL + "/a/b/c/hi", "abc", t)
+	defer httpGetAssert(po, "/a/b/c/hi", "abc", t)
 }
 
 func TestParamInRouter(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	root := po.Root
 	c := root.Router("a/:b/c")
 	b := root.Router("a/:")
@@ -221,11 +214,11 @@ func TestParamInRouter(t *testing.T) {
 	c.Get("hi", func(c *Context) {
 		c.Response.String(c.Request.Param("b"))
 	})
-	defer httpGetAssert(baseURL + "/a/hal/c/hi", "bhal", t)
+	defer httpGetAssert(po, "/a/hal/c/hi", "bhal", t)
 }
 
 func TestRouterConflict(t *testing.T) {
-	po, _ := runPong()
+	po := New()
 	root := po.Root
 	root.Router("/a")
 	root.Router("/a/:b")
@@ -239,92 +232,49 @@ func TestRouterConflict(t *testing.T) {
 }
 
 func TestHead(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	po.Root.Head("/", func(c *Context) {
 		t.Log(`TestDelete`)
 	})
-	defer func() {
-		_, err := http.Head(baseURL)
-		if err != nil {
-			t.Error(err)
-		}
-	}()
+	defer serve(po, http.MethodHead, "/", "", "")
 }
 
 func TestDelete(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	po.Root.Delete("/", func(c *Context) {
 		t.Log(`TestDelete`)
 	})
-	defer func() {
-		client := http.Client{}
-		url, _ := url.Parse(baseURL)
-		_, err := client.Do(&http.Request{
-			Method: http.MethodDelete,
-			URL:    url,
-		})
-		if err != nil {
-			t.Error(err)
-		}
-	}()
+	defer serve(po, http.MethodDelete, "/", "", "")
 }
 
 func TestOptions(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	po.Root.Options("/", func(c *Context) {
 		t.Log(`TestOptions`)
 	})
-	defer func() {
-		client := http.Client{}
-		url, _ := url.Parse(baseURL)
-		client.Do(&http.Request{
-			Method: http.MethodOptions,
-			URL:    url,
-		})
-	}()
+	defer serve(po, http.MethodOptions, "/", "", "")
 }
 
 func TestPatch(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	po.Root.Patch("/", func(c *Context) {
 		t.Log(`TestPatch`)
 	})
-	defer func() {
-		client := http.Client{}
-		url, _ := url.Parse(baseURL)
-		client.Do(&http.Request{
-			Method: http.MethodPatch,
-			URL:    url,
-		})
-	}()
+	defer serve(po, http.MethodPatch, "/", "", "")
 }
 
 func TestPut(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	po.Root.Put("/", func(c *Context) {
 		t.Log(`TestPut`)
 	})
-	defer func() {
-		client := http.Client{}
-		url, _ := url.Parse(baseURL)
-		client.Do(&http.Request{
-			Method: http.MethodPut,
-			URL:    url,
-		})
-	}()
+	defer serve(po, http.MethodPut, "/", "", "")
 }
 
 func TestTrace(t *testing.T) {
-	po, baseURL := runPong()
+	po := New()
 	po.Root.Trace("/", func(c *Context) {
 		t.Log(`TestTrace`)
 	})
-	defer func() {
-		client := http.Client{}
-		url, _ := url.Parse(baseURL)
-		client.Do(&http.Request{
-			Method: http.MethodTrace,
-			URL:    url,
-		})
-	}()
+	defer serve(po, http.MethodTrace, "/", "", "")
 }
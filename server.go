@@ -0,0 +1,139 @@
+package pong
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// listen on TCP network address addr and serve HTTP request with pong.Server
+// Run block until receive SIGINT or SIGTERM, then shutdown gracefully
+// return nil if shutdown success
+func (pong *Pong) Run(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	pong.Server.Addr = addr
+	return pong.serve(listener, pong.Server.Serve)
+}
+
+// listen on TCP network address addr and serve HTTPS request with pong.Server, works like Run
+// certFile and keyFile is used like http.ListenAndServeTLS
+func (pong *Pong) RunTLS(addr string, certFile string, keyFile string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	pong.Server.Addr = addr
+	return pong.serve(listener, func(listener net.Listener) error {
+		return pong.Server.ServeTLS(listener, certFile, keyFile)
+	})
+}
+
+// listen on unix domain socket file and serve HTTP request with pong.Server, works like Run
+// socket file left by last run will be removed before listen, and removed again after shutdown
+func (pong *Pong) RunUnix(file string) error {
+	if info, err := os.Stat(file); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(file)
+	}
+	listener, err := net.Listen("unix", file)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+	return pong.serve(listener, pong.Server.Serve)
+}
+
+// serve HTTP request from listener with pong.Server, works like Run
+func (pong *Pong) RunListener(listener net.Listener) error {
+	return pong.serve(listener, pong.Server.Serve)
+}
+
+func (pong *Pong) serve(listener net.Listener, serve func(net.Listener) error) error {
+	pong.Server.Handler = pong
+	signalContext, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve(listener)
+	}()
+	atomic.StoreInt32(&pong.notReady, 0)
+	for _, handle := range pong.onStartList {
+		handle()
+	}
+	select {
+	case err := <-serveErr:
+		// Shutdown is called by others, who will wait shutdown finish
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	case <-signalContext.Done():
+		stop()
+		return pong.Shutdown(context.Background())
+	}
+}
+
+// shutdown pong.Server gracefully
+// Ready will return false at once and OnShutdown handles will be called, then wait ShutdownDelay before stop accepting new request,
+// and wait running requests finish in ShutdownTimeout or ctx is done, after that all connections will be closed
+func (pong *Pong) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&pong.notReady, 1)
+	for _, handle := range pong.onShutdownList {
+		handle()
+	}
+	if pong.ShutdownDelay > 0 {
+		timer := time.NewTimer(pong.ShutdownDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	if pong.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pong.ShutdownTimeout)
+		defer cancel()
+	}
+	err := pong.Server.Shutdown(ctx)
+	if err != nil {
+		pong.Server.Close()
+	}
+	return err
+}
+
+// add handles which will be called after server start listen
+func (pong *Pong) OnStart(handles ...func()) {
+	pong.onStartList = append(pong.onStartList, handles...)
+}
+
+// add handles which will be called when server begin to shutdown, before stop accepting new request
+func (pong *Pong) OnShutdown(handles ...func()) {
+	pong.onShutdownList = append(pong.onShutdownList, handles...)
+}
+
+// return whether this server is ready to handle request
+// it's false when server is shutting down
+func (pong *Pong) Ready() bool {
+	return atomic.LoadInt32(&pong.notReady) == 0
+}
+
+// a handle for health check, response 200 when Ready, else response 503
+//
+// for example:
+//
+//	po.Root.Get("/ready", po.ReadyHandle)
+func (pong *Pong) ReadyHandle(c *Context) {
+	if pong.Ready() {
+		c.Response.String("ready")
+	} else {
+		c.Response.StatusCode = http.StatusServiceUnavailable
+		c.Response.String("not ready")
+	}
+}
@@ -0,0 +1,66 @@
+package pong
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRunListener(t *testing.T) {
+	po := New()
+	po.ShutdownDelay = 50 * time.Millisecond
+	po.Root.Get("/ready", po.ReadyHandle)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL := "http://" + listener.Addr().String()
+	started := make(chan bool, 1)
+	shutdown := make(chan bool, 1)
+	po.OnStart(func() {
+		started <- true
+	})
+	po.OnShutdown(func() {
+		shutdown <- true
+	})
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- po.RunListener(listener)
+	}()
+	<-started
+	res, err := http.Get(baseURL + "/ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !po.Ready() {
+		t.Error(res.StatusCode)
+	}
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- po.Shutdown(context.Background())
+	}()
+	<-shutdown
+	if po.Ready() {
+		t.Error("should not ready when shutdown")
+	}
+	// still serving in ShutdownDelay, but health check fail
+	res, err = http.Get(baseURL + "/ready")
+	if err != nil {
+		t.Error(err)
+	} else {
+		res.Body.Close()
+		if res.StatusCode != http.StatusServiceUnavailable {
+			t.Error(res.StatusCode)
+		}
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Error(err)
+	}
+	if err := <-runErr; err != nil {
+		t.Error(err)
+	}
+	t.Log(`TestRunListener`)
+}
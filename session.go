@@ -1,8 +1,12 @@
 package pong
 
 import (
-	"net/http"
 	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
 // SessionIO define a interface to handle Session's read and write
@@ -23,98 +27,571 @@ type SessionIO interface {
 	// update the sessionId's value to store
 	// the give value just has changed part not all of the value point to sessionId
 	Write(sessionId string, changes map[string]interface{}) error
+	// remove values by names from the sessionId's value in store, names not exist should be ignore
+	Delete(sessionId string, names ...string) error
+}
+
+// SessionCookieIO is a SessionIO which store the whole session in browser's cookie instead of server side
+// if a SessionIO passed to EnableSession is also a SessionCookieIO,
+// pong will Load session from cookie value and Save it back to cookie just before response is send when session has changed
+type SessionCookieIO interface {
+	SessionIO
+	// decode and verify the cookie value store in browser, return sessionId and whole value in it
+	// a error should be return when cookie value is invalid or has expired, then pong will start a new session
+	Load(cookieValue string) (sessionId string, wholeValue map[string]interface{}, err error)
+	// encode sessionId and whole value to a cookie value
+	// a error should be return when the value can't be store in cookie, like it's too large
+	Save(sessionId string, wholeValue map[string]interface{}) (cookieValue string, err error)
+}
+
+// SessionOptions config the cookie which store sessionId in browser
+// zero value of every field means use default
+type SessionOptions struct {
+	// cookie's name, default is SessionCookiesName
+	CookieName string
+	// cookie's Domain, default is empty means only current host
+	Domain string
+	// cookie's Path, default is "/"
+	Path string
+	// only send cookie over HTTPS
+	Secure bool
+	// cookie's SameSite, default is http.SameSiteLaxMode
+	SameSite http.SameSite
+	// if Persistent is true, cookie will be keep MaxAge seconds in browser even browser has been closed,
+	// else it's a browser-session cookie which is removed when browser is closed
+	Persistent bool
+	// cookie's max age in seconds, only used when Persistent, default is 30 days
+	MaxAge int
+	// used to validate sessionId in cookie before load session from store, invalid sessionId is treat as no session
+	// default is the session store's IDGenerator if the store is a IDGeneratorOwner, else sessionId is not validated
+	IDGenerator IDGenerator
+	// how sessionId is carried between client and server, default is CookieTransport
+	// Router.SessionTransport can overwrite it for a router
+	Transport SessionTransport
+	// if Lock is true and session store is a SessionLocker, session is locked from it's loaded until it's changes are saved,
+	// so concurrent requests of the same session are serialized and never lose update
+	// request wait the lock at most LockTimeout, then ErrorSessionLockTimeout is give to HTTPErrorHandle
+	Lock bool
+	// max time to wait session's lock, default is 10 seconds
+	LockTimeout time.Duration
+	// bind session to client's User-Agent and IP prefix, default bind nothing
+	Binding SessionBinding
+	// session expire AbsoluteTimeout after it's created no matter how active it is, 0 means no absolute lifetime
+	// Context.ResetSession and Context.Login don't extend it
+	AbsoluteTimeout time.Duration
+	// if session store is a SessionAdmin, a session's last seen time, IP and User-Agent are updated at most once every TouchInterval,
+	// so read only requests don't write session store every time, default is 1 minute, negative means update on every access
+	TouchInterval time.Duration
+}
+
+func (options *SessionOptions) withDefault() *SessionOptions {
+	o := *options
+	if len(o.CookieName) == 0 {
+		o.CookieName = SessionCookiesName
+	}
+	if len(o.Path) == 0 {
+		o.Path = "/"
+	}
+	if o.SameSite == 0 {
+		o.SameSite = http.SameSiteLaxMode
+	}
+	if o.Persistent && o.MaxAge <= 0 {
+		o.MaxAge = 30 * 24 * 60 * 60
+	}
+	if o.Transport == nil {
+		o.Transport = CookieTransport{}
+	}
+	if o.LockTimeout <= 0 {
+		o.LockTimeout = 10 * time.Second
+	}
+	if o.TouchInterval == 0 {
+		o.TouchInterval = time.Minute
+	}
+	return &o
+}
+
+// make a cookie to store sessionId in browser
+func (options *SessionOptions) cookie(sessionId string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     options.CookieName,
+		Value:    sessionId,
+		Domain:   options.Domain,
+		Path:     options.Path,
+		Secure:   options.Secure,
+		HttpOnly: true,
+		SameSite: options.SameSite,
+	}
+	if options.Persistent {
+		cookie.MaxAge = options.MaxAge
+	}
+	return cookie
 }
 
+// make a cookie to remove sessionId in browser, it must has the same Domain and Path with the one set it
+func (options *SessionOptions) expiredCookie() *http.Cookie {
+	cookie := options.cookie("")
+	cookie.MaxAge = -1
+	return cookie
+}
+
+// Session is loaded from session manager lazily when it's first accessed,
+// changes are buffered and write to session manager once just before response is send
 type Session struct {
-	pong  *Pong
-	id    string
-	store map[string]interface{}
+	pong    *Pong
+	context *Context
+	id      string
+	store   map[string]interface{}
+	// whether session has been loaded from session manager
+	loaded bool
+	// changes made by Set but not write to session manager
+	changes map[string]interface{}
+	// names removed by Delete but not remove from session manager
+	deletes map[string]bool
+	// whether there are changes should be Save
+	dirty bool
+	// release session's lock, nil if session is not locked
+	unlock func()
+}
+
+// session value name used to store flash messages
+const sessionFlashName = sessionInternalPrefix + "flash"
+
+// load session by sessionId read by SessionTransport when it's first accessed
+// if sessionId is not exist in store, id is empty and a new session will be make when there are changes to Save
+func (s *Session) load() {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.store = make(map[string]interface{})
+	token := s.context.sessionTransportOf().Read(s.context)
+	if len(token) == 0 {
+		return
+	}
+	if cookieIO := s.pong.sessionCookieIO; cookieIO != nil {
+		if id, store, err := cookieIO.Load(token); err == nil {
+			s.id, s.store = id, store
+			s.verify()
+		}
+		return
+	}
+	// garbage or forged sessionId never hit the store
+	if generator := s.pong.sessionOptions.IDGenerator; generator != nil && !generator.Valid(token) {
+		return
+	}
+	if s.pong.sessionLocker != nil {
+		if err := s.lock(token); err != nil {
+			s.context.Abort(err)
+		}
+	}
+	store, err := s.pong.sessionStore.Read(s.context, token)
+	if err != nil {
+		s.release()
+		// stop the handle at where it access Session
+		s.context.Abort(err)
+	}
+	if store == nil {
+		// nothing to protect for a new session
+		s.release()
+		return
+	}
+	s.id, s.store = token, store
+	if s.verify() {
+		s.touch()
+	}
 }
 
 // get the value by name from this session
 func (s *Session) Get(name string) interface{} {
+	s.load()
 	return s.store[name]
 }
 
+// get a value by name from this session and assert it's type is T
+// if the value is not set or type is not T, a zero value and false will return
+func SessionGetAs[T any](s *Session, name string) (value T, ok bool) {
+	value, ok = s.Get(name).(T)
+	return
+}
+
+// get a string value by name from this session
+// if the value is not set or is not a string, defaultValue will return
+func (s *Session) GetString(name string, defaultValue string) string {
+	if value, ok := s.Get(name).(string); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// get a bool value by name from this session
+// if the value is not set or is not a bool, defaultValue will return
+func (s *Session) GetBool(name string, defaultValue bool) bool {
+	if value, ok := s.Get(name).(bool); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// get an int value by name from this session
+// every integer type and float without fractional part can be read, because session store out of memory may change number's type
+// if the value is not set, is not a number or overflow int, defaultValue will return
+func (s *Session) GetInt(name string, defaultValue int) int {
+	switch value := s.Get(name).(type) {
+	case int:
+		return value
+	case int8:
+		return int(value)
+	case int16:
+		return int(value)
+	case int32:
+		return int(value)
+	case int64:
+		if value >= math.MinInt && value <= math.MaxInt {
+			return int(value)
+		}
+	case uint:
+		if value <= math.MaxInt {
+			return int(value)
+		}
+	case uint8:
+		return int(value)
+	case uint16:
+		return int(value)
+	case uint32:
+		if uint64(value) <= math.MaxInt {
+			return int(value)
+		}
+	case uint64:
+		if value <= math.MaxInt {
+			return int(value)
+		}
+	case float32:
+		if f := float64(value); f >= math.MinInt && f < math.MaxInt && float32(int(value)) == value {
+			return int(value)
+		}
+	case float64:
+		if value >= math.MinInt && value < math.MaxInt && float64(int(value)) == value {
+			return int(value)
+		}
+	}
+	return defaultValue
+}
+
+// get a float64 value by name from this session
+// every integer and float type can be read
+// if the value is not set or is not a number, defaultValue will return
+func (s *Session) GetFloat64(name string, defaultValue float64) float64 {
+	switch value := s.Get(name).(type) {
+	case float64:
+		return value
+	case float32:
+		return float64(value)
+	case int:
+		return float64(value)
+	case int8:
+		return float64(value)
+	case int16:
+		return float64(value)
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case uint:
+		return float64(value)
+	case uint8:
+		return float64(value)
+	case uint16:
+		return float64(value)
+	case uint32:
+		return float64(value)
+	case uint64:
+		return float64(value)
+	}
+	return defaultValue
+}
+
 // set a value with name to this session
 // can be used to overwrite old value
+// changes are write to session manager by Session.Save which is called by pong just before response is send
+// if session is store in cookie by SessionCookieIO and changes can't be Save, the error is return and changes will not apply
 func (s *Session) Set(changes map[string]interface{}) error {
+	s.load()
+	old := make(map[string]interface{}, len(changes))
 	for key, value := range changes {
+		if oldValue, has := s.store[key]; has {
+			old[key] = oldValue
+		}
 		s.store[key] = value
 	}
-	return s.pong.sessionManager.Write(s.id, changes)
+	// check whether the cookie can be Save now, so user can know the error
+	if cookieIO := s.pong.sessionCookieIO; cookieIO != nil {
+		if _, err := cookieIO.Save(s.id, s.store); err != nil {
+			for key := range changes {
+				if oldValue, has := old[key]; has {
+					s.store[key] = oldValue
+				} else {
+					delete(s.store, key)
+				}
+			}
+			return err
+		}
+	}
+	if s.changes == nil {
+		s.changes = make(map[string]interface{}, len(changes))
+	}
+	for key, value := range changes {
+		s.changes[key] = value
+		delete(s.deletes, key)
+	}
+	s.dirty = true
+	return nil
+}
+
+// set a single value with name to this session, works like Set
+func (s *Session) Put(name string, value interface{}) error {
+	return s.Set(map[string]interface{}{name: value})
+}
+
+// remove values by names from this session, names not exist will be ignore
+func (s *Session) Delete(names ...string) {
+	s.load()
+	if s.deletes == nil {
+		s.deletes = make(map[string]bool, len(names))
+	}
+	removed := false
+	for _, name := range names {
+		if _, has := s.store[name]; has {
+			removed = true
+		}
+		delete(s.store, name)
+		delete(s.changes, name)
+		s.deletes[name] = true
+	}
+	// delete nothing from a new session don't create it, so client get no cookie
+	if removed || len(s.id) > 0 {
+		s.dirty = true
+	}
+}
+
+// remove all values from this session, session itself and it's id will be keep
+// metadata like created time and client binding is keep too
+func (s *Session) Clear() {
+	s.load()
+	names := make([]string, 0, len(s.store))
+	for name := range s.store {
+		if !isSessionMeta(name) {
+			names = append(names, name)
+		}
+	}
+	s.Delete(names...)
+}
+
+// return names of all values in this session in sorted order, values used by pong itself like flash messages are not include
+func (s *Session) Keys() []string {
+	s.load()
+	names := make([]string, 0, len(s.store))
+	for name := range s.store {
+		if !strings.HasPrefix(name, sessionInternalPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// return this session's id
+// a new session has no id until it's changes are Save, so empty string will be return
+func (s *Session) ID() string {
+	s.load()
+	return s.id
+}
+
+// return whether this session is not exist in session manager yet
+// a new session will be make when it has changes to Save
+func (s *Session) IsNew() bool {
+	s.load()
+	return len(s.id) == 0
+}
+
+// add a flash message to this session, it can be read once by Flashes in next request
+func (s *Session) AddFlash(message string) error {
+	return s.Put(sessionFlashName, append(s.flashes(), message))
+}
+
+// return flash messages add by AddFlash and remove them from this session, so they will only be read once
+func (s *Session) Flashes() []string {
+	messages := s.flashes()
+	if len(messages) > 0 {
+		s.Delete(sessionFlashName)
+	}
+	return messages
+}
+
+// session manager may change []string to []interface{} like JSON
+func (s *Session) flashes() []string {
+	switch value := s.Get(sessionFlashName).(type) {
+	case []string:
+		return append([]string{}, value...)
+	case []interface{}:
+		messages := make([]string, 0, len(value))
+		for _, v := range value {
+			if message, ok := v.(string); ok {
+				messages = append(messages, message)
+			}
+		}
+		return messages
+	}
+	return nil
+}
+
+// write changes made by Set to session manager now, if session is not exist a new one will be make and it's sessionId will be send to client by SessionTransport
+// pong call it just before response is send, call it yourself if you want to handle the error
+// Save after response has been send will not update cookie in browser
+func (s *Session) Save() error {
+	if !s.dirty {
+		return nil
+	}
+	newSession := len(s.id) == 0
+	if newSession {
+		s.stamp()
+	}
+	if cookieIO := s.pong.sessionCookieIO; cookieIO != nil {
+		if newSession {
+			s.id = cookieIO.NewSession()
+		}
+		cookieValue, err := cookieIO.Save(s.id, s.store)
+		if err != nil {
+			return err
+		}
+		s.context.sessionTransportOf().Write(s.context, cookieValue)
+	} else {
+		sessionStore := s.pong.sessionStore
+		if newSession {
+			id, err := sessionStore.NewSession(s.context)
+			if err != nil {
+				return err
+			}
+			s.id = id
+		}
+		if len(s.changes) > 0 {
+			if err := sessionStore.Write(s.context, s.id, s.changes); err != nil {
+				return err
+			}
+		}
+		if len(s.deletes) > 0 && !newSession {
+			names := make([]string, 0, len(s.deletes))
+			for name := range s.deletes {
+				names = append(names, name)
+			}
+			if err := sessionStore.Delete(s.context, s.id, names...); err != nil {
+				return err
+			}
+		}
+		if newSession {
+			s.touch()
+			s.context.sessionTransportOf().Write(s.context, s.id)
+		}
+	}
+	s.changes = nil
+	s.deletes = nil
+	s.dirty = false
+	return nil
 }
 
 // update old sessionId with new one
 // this will update sessionId store in browser's cookie and session manager's store
+// if there is no session yet, a new one will be make before response is send
 func (c *Context) ResetSession() error {
-	sessionManager := c.pong.sessionManager
-	newId, err := sessionManager.Reset(c.Session.id)
-	if err != nil {
-		return err
-	}
-	c.Session.id = newId
-	//update sessionID in cookies
-	c.Response.Cookie(&http.Cookie{
-		HttpOnly: true,
-		Name:     SessionCookiesName,
-		Value:    newId,
-	})
-	return nil
+	return c.Session.Regenerate()
 }
 
 // remove sessionId
 // this will remove sessionId store in browser's cookie and session manager's store
+// c.Session is empty after destroy, put values to it will make a new session
 func (c *Context) DestorySession() error {
-	err := c.pong.sessionManager.Destory(c.Session.id)
-	if err != nil {
-		return err
+	c.Session.load()
+	if len(c.Session.id) > 0 {
+		err := c.pong.sessionStore.Destory(c, c.Session.id)
+		if err != nil {
+			return err
+		}
 	}
-	c.Session = nil
-	//delete sessionID in cookies
-	c.Response.Cookie(&http.Cookie{
-		Name:   SessionCookiesName,
-		MaxAge: -1,
-	})
+	// keep an empty session, so Session can still be used after destroy, a new session is make if it has changes
+	c.Session.drop(false)
+	//tell client to delete sessionID
+	c.sessionTransportOf().Clear(c)
 	return nil
 }
 
 // if you want you HTTP session call this
 // EnableSession will use memory to store session data
-// EnableSession will read sessionId from request cookies value by name SessionCookiesName default is "SESSIONID" as sessionId
-// EnableSession will cause performance drop compare to not use Session
-func (pong *Pong) EnableSession(sessionManager SessionIO) {
-	if pong.sessionManager != nil {
-		fmt.Errorf("sessionManager %v has been set, don't call EnableSession more than once", pong.sessionManager)
+// EnableSession will read sessionId from request cookies value by name SessionOptions.CookieName default is "SESSIONID" as sessionId
+// options is optional to config the cookie, only the first one is used
+// session is only loaded from session manager when it's accessed, and a cookie is only set when session has changes,
+// so request not use session like static file and health check cost nothing
+// EnableSession use a v1 SessionIO by AdaptSessionIO, use EnableSessionStore if your store can report error
+func (pong *Pong) EnableSession(sessionManager SessionIO, options ...SessionOptions) {
+	pong.EnableSessionStore(AdaptSessionIO(sessionManager), options...)
+}
+
+// works like EnableSession but use a v2 SessionStore
+// if SessionStore fail to load session when Session is accessed, the handle stop and the error is give to HTTPErrorHandle,
+// if session fail to save before response is send, the handle's response is drop and the error is give to HTTPErrorHandle,
+// call Session.Save yourself to handle the error in the handle
+func (pong *Pong) EnableSessionStore(sessionStore SessionStore, options ...SessionOptions) {
+	if pong.sessionStore != nil {
+		fmt.Errorf("sessionStore %v has been set, don't call EnableSession more than once", pong.sessionStore)
 		return
 	}
-	pong.sessionManager = sessionManager
+	pong.sessionStore = sessionStore
+	pong.sessionOptions = (&SessionOptions{}).withDefault()
+	if len(options) > 0 {
+		pong.sessionOptions = options[0].withDefault()
+	}
+	owner, hasGenerator := sessionStore.(IDGeneratorOwner)
+	if adapter, ok := sessionStore.(sessionIOAdapter); ok {
+		if cookieIO, ok := adapter.SessionIO.(SessionCookieIO); ok {
+			pong.sessionCookieIO = cookieIO
+		}
+		owner, hasGenerator = adapter.SessionIO.(IDGeneratorOwner)
+	}
+	if pong.sessionOptions.IDGenerator == nil && hasGenerator {
+		pong.sessionOptions.IDGenerator = owner.IDGenerator()
+	}
+	if pong.sessionOptions.Lock {
+		pong.sessionLocker = SessionLockerOf(sessionStore)
+	}
+	pong.sessionAdmin = SessionAdminOf(sessionStore)
+	if pong.sessionAdmin != nil && pong.sessionOptions.TouchInterval > 0 {
+		pong.sessionTouches = newSessionTouches(pong.sessionOptions.TouchInterval)
+	}
 	pong.Root.Middleware(func(c *Context) {
 		c.Session = &Session{
-			pong:  c.pong,
-			store: make(map[string]interface{}),
-		}
-		sCookie, err := c.Request.HTTPRequest.Cookie(SessionCookiesName)
-		if err == nil {
-			c.Session.id = sCookie.Value
-			if c.pong.sessionManager.Has(c.Session.id) {
-				c.Session.store = c.pong.sessionManager.Read(c.Session.id)
-			} else {
-				goto noSessionID
-			}
-		} else {
-			goto noSessionID
+			pong:    c.pong,
+			context: c,
 		}
+		c.Response.BeforeSend(saveSession)
+		c.Response.AfterSend(releaseSession)
+	})
+}
+
+// write Session's changes before response is send
+// if changes fail to be write, the error is give to HTTPErrorHandle instead of what the handle write
+func saveSession(c *Context) {
+	// Session is nil in a Context forked by timeout
+	if c.Session == nil {
 		return
-		noSessionID:
-		{
-			c.Session.id = c.pong.sessionManager.NewSession()
-			c.Response.Cookie(&http.Cookie{
-				HttpOnly: true,
-				Name:     SessionCookiesName,
-				Value:    c.Session.id,
-			})
-		}
+	}
+	err := c.Session.Save()
+	c.Session.release()
+	if err != nil {
+		c.Abort(err)
+	}
+}
 
-	})
+// release Session's lock if response is send without saveSession, like hijacked
+func releaseSession(c *Context) {
+	if c.Session != nil {
+		c.Session.release()
+	}
 }
@@ -0,0 +1,115 @@
+/*
+codec has pong.SessionCodec implementations share one type registry:
+
+	Gob     encoding/gob, compact and fast, only readable by Go
+	JSON    encoding/json with every value wrapped by it's type name, session data is readable
+	MsgPack MessagePack with every interface value wrapped by it's type name, compact and readable by other languages
+
+every codec keep value's type, so value read from session has the same type as it's set.
+build in types like string, bool, numbers, []byte, []string, map[string]string, time.Time, time.Duration,
+map[string]interface{} and []interface{} are registered, register your struct by Register before use it in session:
+
+	codec.Register(User{})
+
+Register also register the type to gob, so you don't need to call gob.Register.
+like gob, register T or *T but not both.
+*/
+package codec
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+)
+
+var (
+	_ pong.SessionCodec = Gob{}
+	_ pong.SessionCodec = JSON{}
+	_ pong.SessionCodec = MsgPack{}
+)
+
+var (
+	// this error will be return when encode or decode a value which type is not registered
+	ErrUnregisteredType = errors.New("codec:type is not registered, call codec.Register first")
+	// this error will be return when encode a value which type can't be encoded, like func and chan
+	ErrUnsupportedType = errors.New("codec:type is not supported")
+	// this error will be return when decode data which is not make by the codec or has been broken
+	ErrInvalidData = errors.New("codec:invalid data")
+)
+
+var registry = struct {
+	lock  sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}{
+	types: make(map[string]reflect.Type),
+	names: make(map[reflect.Type]string),
+}
+
+func init() {
+	for _, value := range []interface{}{
+		false, "",
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+		[]byte(nil), []string(nil), []int(nil), []int64(nil), []float64(nil), []bool(nil),
+		map[string]string(nil), map[string]int(nil),
+		map[string]interface{}(nil), []interface{}(nil),
+		time.Time{}, time.Duration(0),
+	} {
+		Register(value)
+	}
+}
+
+// name a type like gob.Register, so a type has the same name in every codec and gob
+func typeName(t reflect.Type) string {
+	if t.Name() == "" {
+		return t.String()
+	}
+	if t.PkgPath() == "" {
+		return t.Name()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// register value's type so it can be store in session, value is only used to tell the type
+// type is named by it's package path and name like gob.Register
+func Register(value interface{}) {
+	RegisterName(typeName(reflect.TypeOf(value)), value)
+}
+
+// register value's type with name, use it to give a short and stable name to a type
+// it panic like gob.RegisterName if the name or type has been registered with different one, T and *T are the same type to gob
+func RegisterName(name string, value interface{}) {
+	t := reflect.TypeOf(value)
+	gob.RegisterName(name, value)
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.types[name] = t
+	registry.names[t] = name
+}
+
+func nameOf(t reflect.Type) (string, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	name, ok := registry.names[t]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnregisteredType, t)
+	}
+	return name, nil
+}
+
+func typeOf(name string) (reflect.Type, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	t, ok := registry.types[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnregisteredType, name)
+	}
+	return t, nil
+}
@@ -0,0 +1,104 @@
+package codec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/session/codec"
+	"github.com/gwuhaolin/pong/session/sessiontest"
+)
+
+func TestCodec(t *testing.T) {
+	for name, sessionCodec := range map[string]pong.SessionCodec{"Gob": codec.Gob{}, "JSON": codec.JSON{}, "MsgPack": codec.MsgPack{}} {
+		t.Run(name, func(t *testing.T) {
+			sessiontest.RunCodec(t, sessionCodec)
+		})
+	}
+}
+
+type unregistered struct {
+	Name string
+}
+
+func TestUnregisteredType(t *testing.T) {
+	for name, sessionCodec := range map[string]pong.SessionCodec{"JSON": codec.JSON{}, "MsgPack": codec.MsgPack{}} {
+		if _, err := sessionCodec.Marshal(unregistered{}); !errors.Is(err, codec.ErrUnregisteredType) {
+			t.Error(name, err)
+		}
+		if _, err := sessionCodec.Marshal([]interface{}{unregistered{}}); !errors.Is(err, codec.ErrUnregisteredType) {
+			t.Error(name, err)
+		}
+	}
+	if _, err := (codec.JSON{}).Unmarshal([]byte(`{"t":"not.Registered","v":1}`)); !errors.Is(err, codec.ErrUnregisteredType) {
+		t.Error(err)
+	}
+	if _, err := (codec.MsgPack{}).Marshal(func() {}); !errors.Is(err, codec.ErrUnregisteredType) {
+		t.Error(err)
+	}
+	if _, err := (codec.MsgPack{}).Marshal(map[string]interface{}{"ch": make(chan int)}); !errors.Is(err, codec.ErrUnregisteredType) {
+		t.Error(err)
+	}
+}
+
+func TestRegisterName(t *testing.T) {
+	type short struct {
+		Name string
+	}
+	codec.RegisterName("short", short{})
+	data, err := codec.JSON{}.Marshal(short{Name: "pong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"t":"short","v":{"Name":"pong"}}` {
+		t.Error(string(data))
+	}
+	if value, err := (codec.MsgPack{}).Unmarshal(mustMarshal(t, codec.MsgPack{}, short{Name: "pong"})); err != nil || value != (short{Name: "pong"}) {
+		t.Error(value, err)
+	}
+}
+
+func mustMarshal(t *testing.T, sessionCodec pong.SessionCodec, value interface{}) []byte {
+	t.Helper()
+	data, err := sessionCodec.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// MessagePack data should be readable by other languages, so check the format of plain values
+func TestMsgPackFormat(t *testing.T) {
+	// array [type name, value]
+	if data := mustMarshal(t, codec.MsgPack{}, 1); string(data) != "\x92\xa3int\x01" {
+		t.Errorf("%q", data)
+	}
+	if data := mustMarshal(t, codec.MsgPack{}, -33); string(data) != "\x92\xa3int\xd0\xdf" {
+		t.Errorf("%q", data)
+	}
+	if data := mustMarshal(t, codec.MsgPack{}, nil); string(data) != "\xc0" {
+		t.Errorf("%q", data)
+	}
+	if data := mustMarshal(t, codec.MsgPack{}, map[string]string{"a": "b"}); string(data) != "\x92\xb1map[string]string\x81\xa1a\xa1b" {
+		t.Errorf("%q", data)
+	}
+}
+
+func TestMsgPackInvalidData(t *testing.T) {
+	valid := mustMarshal(t, codec.MsgPack{}, sessiontest.Values())
+	// every truncated data should return error but not panic
+	for i := 0; i < len(valid); i++ {
+		if _, err := (codec.MsgPack{}).Unmarshal(valid[:i]); err == nil {
+			t.Fatal("truncated data should be invalid", i)
+		}
+	}
+	// large length with little data should not allocate a lot
+	for _, data := range []string{"\x92\xa3int\xdd\xff\xff\xff\xff", "\x92\xb1map[string]string\xdf\xff\xff\xff\xff", "\x92\xa6string\xdb\xff\xff\xff\xff"} {
+		if _, err := (codec.MsgPack{}).Unmarshal([]byte(data)); err == nil {
+			t.Errorf("%q should be invalid", data)
+		}
+	}
+	if _, err := (codec.MsgPack{}).Unmarshal(append(mustMarshal(t, codec.MsgPack{}, 1), 0)); err != codec.ErrInvalidData {
+		t.Error("data left should be invalid", err)
+	}
+}
@@ -0,0 +1,20 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Gob use encoding/gob to encode session value
+type Gob struct{}
+
+func (Gob) Marshal(value interface{}) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	err := gob.NewEncoder(&buffer).Encode(&value)
+	return buffer.Bytes(), err
+}
+
+func (Gob) Unmarshal(data []byte) (value interface{}, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return
+}
@@ -0,0 +1,124 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+var (
+	mapType   = reflect.TypeOf(map[string]interface{}(nil))
+	sliceType = reflect.TypeOf([]interface{}(nil))
+	jsonNull  = []byte("null")
+)
+
+// JSON use encoding/json to encode session value, every value is wrapped as {"t":type name,"v":value} so it's type is keep
+// value in map[string]interface{} and []interface{} is wrapped too, but interface{} field in struct will lose it's type
+type JSON struct{}
+
+// a value wrapped by it's type name
+type jsonValue struct {
+	Type  string      `json:"t"`
+	Value interface{} `json:"v"`
+}
+
+type rawJSONValue struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v"`
+}
+
+func (JSON) Marshal(value interface{}) ([]byte, error) {
+	wrapped, err := wrapJSON(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(wrapped)
+}
+
+func (JSON) Unmarshal(data []byte) (interface{}, error) {
+	return unwrapJSON(data)
+}
+
+func wrapJSON(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	name, err := nameOf(reflect.TypeOf(value))
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v != nil {
+			wrapped := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				if wrapped[key], err = wrapJSON(item); err != nil {
+					return nil, err
+				}
+			}
+			value = wrapped
+		}
+	case []interface{}:
+		if v != nil {
+			wrapped := make([]interface{}, len(v))
+			for i, item := range v {
+				if wrapped[i], err = wrapJSON(item); err != nil {
+					return nil, err
+				}
+			}
+			value = wrapped
+		}
+	}
+	return jsonValue{Type: name, Value: value}, nil
+}
+
+func unwrapJSON(data []byte) (interface{}, error) {
+	if bytes.Equal(bytes.TrimSpace(data), jsonNull) {
+		return nil, nil
+	}
+	raw := rawJSONValue{}
+	if err := json.Unmarshal(data, &raw); err != nil || len(raw.Type) == 0 {
+		return nil, ErrInvalidData
+	}
+	t, err := typeOf(raw.Type)
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case mapType:
+		var items map[string]json.RawMessage
+		if err := json.Unmarshal(raw.Value, &items); err != nil {
+			return nil, ErrInvalidData
+		}
+		if items == nil {
+			return map[string]interface{}(nil), nil
+		}
+		value := make(map[string]interface{}, len(items))
+		for key, item := range items {
+			if value[key], err = unwrapJSON(item); err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	case sliceType:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw.Value, &items); err != nil {
+			return nil, ErrInvalidData
+		}
+		if items == nil {
+			return []interface{}(nil), nil
+		}
+		value := make([]interface{}, len(items))
+		for i, item := range items {
+			if value[i], err = unwrapJSON(item); err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	}
+	pointer := reflect.New(t)
+	if err := json.Unmarshal(raw.Value, pointer.Interface()); err != nil {
+		return nil, ErrInvalidData
+	}
+	return pointer.Elem().Interface(), nil
+}
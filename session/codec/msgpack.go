@@ -0,0 +1,586 @@
+package codec
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// MessagePack format bytes
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+	mpFixMap   = 0x80
+	mpFixArray = 0x90
+	mpFixStr   = 0xa0
+)
+
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// MsgPack encode session value to MessagePack, every interface value is encoded as array [type name, value] so it's type is keep,
+// struct is encoded as map of it's exported fields, type implement encoding.BinaryMarshaler like time.Time is encoded as bin
+// other languages can read it as plain MessagePack
+type MsgPack struct{}
+
+func (MsgPack) Marshal(value interface{}) ([]byte, error) {
+	return appendMsgPack(nil, reflect.ValueOf(&value).Elem())
+}
+
+func (MsgPack) Unmarshal(data []byte) (interface{}, error) {
+	var value interface{}
+	d := &msgPackDecoder{data: data}
+	if err := d.decode(reflect.ValueOf(&value).Elem()); err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, ErrInvalidData
+	}
+	return value, nil
+}
+
+func appendMsgPack(bs []byte, v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	if t.Kind() != reflect.Interface && t.Kind() != reflect.Ptr && t.Implements(binaryMarshalerType) && reflect.PointerTo(t).Implements(binaryUnmarshalerType) {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return appendBin(bs, data), nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(bs, mpTrue), nil
+		}
+		return append(bs, mpFalse), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendInt(bs, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendUint(bs, v.Uint()), nil
+	case reflect.Float32:
+		bs = append(bs, mpFloat32)
+		return binary.BigEndian.AppendUint32(bs, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		bs = append(bs, mpFloat64)
+		return binary.BigEndian.AppendUint64(bs, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendString(bs, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(bs, mpNil), nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return appendBin(bs, v.Bytes()), nil
+		}
+		return appendArray(bs, v)
+	case reflect.Array:
+		return appendArray(bs, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(bs, mpNil), nil
+		}
+		bs = appendLength(bs, v.Len(), mpFixMap, 16, mpMap16, mpMap32)
+		var err error
+		for iter := v.MapRange(); iter.Next(); {
+			if bs, err = appendMsgPack(bs, iter.Key()); err != nil {
+				return nil, err
+			}
+			if bs, err = appendMsgPack(bs, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return bs, nil
+	case reflect.Struct:
+		fields := make([]int, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				fields = append(fields, i)
+			}
+		}
+		bs = appendLength(bs, len(fields), mpFixMap, 16, mpMap16, mpMap32)
+		var err error
+		for _, i := range fields {
+			bs = appendString(bs, t.Field(i).Name)
+			if bs, err = appendMsgPack(bs, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return bs, nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return append(bs, mpNil), nil
+		}
+		return appendMsgPack(bs, v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return append(bs, mpNil), nil
+		}
+		elem := v.Elem()
+		name, err := nameOf(elem.Type())
+		if err != nil {
+			return nil, err
+		}
+		bs = append(bs, mpFixArray|2)
+		bs = appendString(bs, name)
+		return appendMsgPack(bs, elem)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, t)
+}
+
+func appendInt(bs []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendUint(bs, uint64(i))
+	case i >= -32:
+		return append(bs, byte(i))
+	case i >= math.MinInt8:
+		return append(bs, mpInt8, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(bs, mpInt16), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(bs, mpInt32), uint32(i))
+	}
+	return binary.BigEndian.AppendUint64(append(bs, mpInt64), uint64(i))
+}
+
+func appendUint(bs []byte, u uint64) []byte {
+	switch {
+	case u <= math.MaxInt8:
+		return append(bs, byte(u))
+	case u <= math.MaxUint8:
+		return append(bs, mpUint8, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(bs, mpUint16), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(bs, mpUint32), uint32(u))
+	}
+	return binary.BigEndian.AppendUint64(append(bs, mpUint64), u)
+}
+
+// append length header, fix format is used if length < fixMax
+func appendLength(bs []byte, length int, fix byte, fixMax int, format16 byte, format32 byte) []byte {
+	switch {
+	case length < fixMax:
+		return append(bs, fix|byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(bs, format16), uint16(length))
+	}
+	return binary.BigEndian.AppendUint32(append(bs, format32), uint32(length))
+}
+
+func appendString(bs []byte, s string) []byte {
+	if len(s) >= 32 && len(s) <= math.MaxUint8 {
+		bs = append(bs, mpStr8, byte(len(s)))
+	} else {
+		bs = appendLength(bs, len(s), mpFixStr, 32, mpStr16, mpStr32)
+	}
+	return append(bs, s...)
+}
+
+func appendBin(bs []byte, data []byte) []byte {
+	switch {
+	case len(data) <= math.MaxUint8:
+		bs = append(bs, mpBin8, byte(len(data)))
+	case len(data) <= math.MaxUint16:
+		bs = binary.BigEndian.AppendUint16(append(bs, mpBin16), uint16(len(data)))
+	default:
+		bs = binary.BigEndian.AppendUint32(append(bs, mpBin32), uint32(len(data)))
+	}
+	return append(bs, data...)
+}
+
+func appendArray(bs []byte, v reflect.Value) ([]byte, error) {
+	bs = appendLength(bs, v.Len(), mpFixArray, 16, mpArray16, mpArray32)
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if bs, err = appendMsgPack(bs, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return bs, nil
+}
+
+type msgPackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgPackDecoder) peek() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, ErrInvalidData
+	}
+	return d.data[d.pos], nil
+}
+
+func (d *msgPackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, ErrInvalidData
+	}
+	bs := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return bs, nil
+}
+
+func (d *msgPackDecoder) readByte() (byte, error) {
+	bs, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return bs[0], nil
+}
+
+// read a big endian unsigned integer has size bytes
+func (d *msgPackDecoder) readSize(size int) (uint64, error) {
+	bs, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(bs[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(bs)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(bs)), nil
+	}
+	return binary.BigEndian.Uint64(bs), nil
+}
+
+// read any integer format, unsigned is true if it's not negative
+func (d *msgPackDecoder) readInteger() (i int64, u uint64, unsigned bool, err error) {
+	b, err := d.readByte()
+	if err != nil {
+		return
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), uint64(b), true, nil
+	case b >= 0xe0:
+		return int64(int8(b)), 0, false, nil
+	case b >= mpUint8 && b <= mpUint64:
+		u, err = d.readSize(1 << (b - mpUint8))
+		return int64(u), u, true, err
+	case b >= mpInt8 && b <= mpInt64:
+		size := 1 << (b - mpInt8)
+		if u, err = d.readSize(size); err != nil {
+			return
+		}
+		// sign extend
+		shift := 64 - 8*uint(size)
+		i = int64(u<<shift) >> shift
+		return i, uint64(i), i >= 0, nil
+	}
+	return 0, 0, false, ErrInvalidData
+}
+
+func (d *msgPackDecoder) readLength(b byte, fix byte, fixMask byte, format8 byte, format16 byte, format32 byte) (int, error) {
+	switch {
+	case b&^fixMask == fix:
+		return int(b & fixMask), nil
+	case b == format8 && format8 != 0:
+		n, err := d.readSize(1)
+		return int(n), err
+	case b == format16:
+		n, err := d.readSize(2)
+		return int(n), err
+	case b == format32:
+		n, err := d.readSize(4)
+		return int(n), err
+	}
+	return 0, ErrInvalidData
+}
+
+func (d *msgPackDecoder) readString() (string, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return "", err
+	}
+	n, err := d.readLength(b, mpFixStr, 0x1f, mpStr8, mpStr16, mpStr32)
+	if err != nil {
+		return "", err
+	}
+	bs, err := d.read(n)
+	return string(bs), err
+}
+
+func (d *msgPackDecoder) readBin() ([]byte, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if b < mpBin8 || b > mpBin32 {
+		return nil, ErrInvalidData
+	}
+	n, err := d.readSize(1 << (b - mpBin8))
+	if err != nil {
+		return nil, err
+	}
+	return d.read(int(n))
+}
+
+// read array or map length, every element has one byte at least so length can't be larger than data left
+func (d *msgPackDecoder) readContainer(isMap bool) (int, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if isMap {
+		n, err = d.readLength(b, mpFixMap, 0x0f, 0, mpMap16, mpMap32)
+	} else {
+		n, err = d.readLength(b, mpFixArray, 0x0f, 0, mpArray16, mpArray32)
+	}
+	if err == nil && n > len(d.data)-d.pos {
+		return 0, ErrInvalidData
+	}
+	return n, err
+}
+
+// skip a value, used for struct field not exist
+func (d *msgPackDecoder) skip() error {
+	b, err := d.peek()
+	if err != nil {
+		return err
+	}
+	switch {
+	case b == mpNil || b == mpTrue || b == mpFalse:
+		d.pos++
+		return nil
+	case b == mpFloat32:
+		_, err = d.read(5)
+		return err
+	case b == mpFloat64:
+		_, err = d.read(9)
+		return err
+	case b <= 0x7f || b >= 0xe0 || (b >= mpUint8 && b <= mpInt64):
+		_, _, _, err = d.readInteger()
+		return err
+	case b&^0x1f == mpFixStr || (b >= mpStr8 && b <= mpStr32):
+		_, err = d.readString()
+		return err
+	case b >= mpBin8 && b <= mpBin32:
+		_, err = d.readBin()
+		return err
+	case b&^0x0f == mpFixArray || b == mpArray16 || b == mpArray32:
+		n, err := d.readContainer(false)
+		for i := 0; i < n && err == nil; i++ {
+			err = d.skip()
+		}
+		return err
+	case b&^0x0f == mpFixMap || b == mpMap16 || b == mpMap32:
+		n, err := d.readContainer(true)
+		for i := 0; i < 2*n && err == nil; i++ {
+			err = d.skip()
+		}
+		return err
+	}
+	return ErrInvalidData
+}
+
+func (d *msgPackDecoder) decode(v reflect.Value) error {
+	b, err := d.peek()
+	if err != nil {
+		return err
+	}
+	t := v.Type()
+	if b == mpNil {
+		d.pos++
+		v.Set(reflect.Zero(t))
+		return nil
+	}
+	if t.Kind() != reflect.Interface && t.Kind() != reflect.Ptr && t.Implements(binaryMarshalerType) && reflect.PointerTo(t).Implements(binaryUnmarshalerType) {
+		data, err := d.readBin()
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		d.pos++
+		switch b {
+		case mpTrue:
+			v.SetBool(true)
+		case mpFalse:
+			v.SetBool(false)
+		default:
+			return ErrInvalidData
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, u, unsigned, err := d.readInteger()
+		if err != nil {
+			return err
+		}
+		if (unsigned && u > math.MaxInt64) || v.OverflowInt(i) {
+			return ErrInvalidData
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		_, u, unsigned, err := d.readInteger()
+		if err != nil {
+			return err
+		}
+		if !unsigned || v.OverflowUint(u) {
+			return ErrInvalidData
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		d.pos++
+		switch b {
+		case mpFloat32:
+			u, err := d.readSize(4)
+			if err != nil {
+				return err
+			}
+			v.SetFloat(float64(math.Float32frombits(uint32(u))))
+		case mpFloat64:
+			u, err := d.readSize(8)
+			if err != nil {
+				return err
+			}
+			v.SetFloat(math.Float64frombits(u))
+		default:
+			return ErrInvalidData
+		}
+		return nil
+	case reflect.String:
+		s, err := d.readString()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+		return nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			data, err := d.readBin()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append(make([]byte, 0, len(data)), data...))
+			return nil
+		}
+		n, err := d.readContainer(false)
+		if err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(t, n, n)
+		for i := 0; i < n; i++ {
+			if err = d.decode(slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Array:
+		n, err := d.readContainer(false)
+		if err != nil {
+			return err
+		}
+		if n != v.Len() {
+			return ErrInvalidData
+		}
+		for i := 0; i < n; i++ {
+			if err = d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		n, err := d.readContainer(true)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(t, n)
+		for i := 0; i < n; i++ {
+			key := reflect.New(t.Key()).Elem()
+			if err = d.decode(key); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err = d.decode(value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		n, err := d.readContainer(true)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			name, err := d.readString()
+			if err != nil {
+				return err
+			}
+			if field, ok := t.FieldByName(name); ok && field.IsExported() && len(field.Index) == 1 {
+				err = d.decode(v.Field(field.Index[0]))
+			} else {
+				err = d.skip()
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Ptr:
+		pointer := reflect.New(t.Elem())
+		if err := d.decode(pointer.Elem()); err != nil {
+			return err
+		}
+		v.Set(pointer)
+		return nil
+	case reflect.Interface:
+		if n, err := d.readContainer(false); err != nil || n != 2 {
+			return ErrInvalidData
+		}
+		name, err := d.readString()
+		if err != nil {
+			return err
+		}
+		elemType, err := typeOf(name)
+		if err != nil {
+			return err
+		}
+		if !elemType.AssignableTo(t) {
+			return ErrInvalidData
+		}
+		elem := reflect.New(elemType).Elem()
+		if err = d.decode(elem); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedType, t)
+}
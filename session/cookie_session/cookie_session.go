@@ -0,0 +1,240 @@
+package cookie_session
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+)
+
+const (
+	// browser only accept cookie not larger than 4KB include it's name and attributes
+	// so default MaxSize leave some room for them
+	defaultMaxSize = 4096 - 256
+	// key should not be shorter than minKeySize
+	minKeySize = 16
+)
+
+var (
+	// this error will be return when encoded session is larger than Options.MaxSize, so browser will not store it
+	ErrCookieTooLarge = errors.New("cookie_session:session is too large to store in cookie")
+	// this error will be return when cookie value is not make by this store or has been tampered
+	ErrInvalidCookie = errors.New("cookie_session:invalid session cookie")
+	// this error will be return when session in cookie has expired
+	ErrSessionExpired = errors.New("cookie_session:session has expired")
+	// this error will be return when make a store without key or key is too short
+	ErrInvalidKey = fmt.Errorf("cookie_session:need at least one key and every key must has %d bytes at least", minKeySize)
+)
+
+var _ pong.SessionCookieIO = (*Store)(nil)
+
+// Options config a cookie session store
+// zero value of every field means use default
+type Options struct {
+	// session expire after MaxAge since last change, expire time is store in encrypted cookie so can't be changed by client
+	// default is 24 hours
+	MaxAge time.Duration
+	// max length of cookie value, Save will return ErrCookieTooLarge if session is too large
+	// default is 3840 bytes, leave some room for cookie's name and attributes in browser's 4KB limit
+	MaxSize int
+	// used to generate sessionId which is store in encrypted cookie, default is pong.RandomIDGenerator
+	IDGenerator pong.IDGenerator
+}
+
+// Store is a SessionCookieIO which store the whole session in browser's cookie
+// session is encode by gob, encrypted by AES-GCM and authenticated by HMAC-SHA256,
+// so value which type is struct should be registered by gob.Register first
+// nothing is store in server side, so it works for stateless deployments behind a load balancer,
+// but a session can't be destroyed in server side, DestorySession just remove the cookie
+type Store struct {
+	options Options
+	// keys[0] is used to encrypt, all of keys are used to decrypt
+	keys []*key
+	now  func() time.Time
+}
+
+// a key give by user derive to a encrypt key and a sign key
+type key struct {
+	aead    cipher.AEAD
+	signKey []byte
+}
+
+// the data encrypted in cookie
+type payload struct {
+	Id      string
+	Expires int64
+	Values  map[string]interface{}
+}
+
+func derive(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func newKey(secret []byte) (*key, error) {
+	if len(secret) < minKeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(derive(secret, "pong cookie_session encrypt"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &key{
+		aead:    aead,
+		signKey: derive(secret, "pong cookie_session sign"),
+	}, nil
+}
+
+// make a cookie session store with default Options
+// keys[0] is used to encrypt new cookie, and all of keys can decrypt cookie,
+// so to rotate key put the new key first and keep old keys after it until cookies make by them expire
+func New(keys ...[]byte) (*Store, error) {
+	return NewWithOptions(Options{}, keys...)
+}
+
+// make a cookie session store with options, see New for keys
+func NewWithOptions(options Options, keys ...[]byte) (*Store, error) {
+	if len(keys) == 0 {
+		return nil, ErrInvalidKey
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = 24 * time.Hour
+	}
+	if options.MaxSize <= 0 {
+		options.MaxSize = defaultMaxSize
+	}
+	if options.IDGenerator == nil {
+		options.IDGenerator = pong.RandomIDGenerator{}
+	}
+	store := &Store{
+		options: options,
+		now:     time.Now,
+	}
+	for _, secret := range keys {
+		k, err := newKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		store.keys = append(store.keys, k)
+	}
+	return store, nil
+}
+
+// encode sessionId and whole value to a encrypted and signed cookie value
+func (store *Store) Save(sessionId string, wholeValue map[string]interface{}) (string, error) {
+	buffer := bytes.Buffer{}
+	err := gob.NewEncoder(&buffer).Encode(&payload{
+		Id:      sessionId,
+		Expires: store.now().Add(store.options.MaxAge).UnixNano(),
+		Values:  wholeValue,
+	})
+	if err != nil {
+		return "", err
+	}
+	k := store.keys[0]
+	data := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+buffer.Len()+k.aead.Overhead()+sha256.Size)
+	if _, err = io.ReadFull(rand.Reader, data); err != nil {
+		return "", err
+	}
+	data = k.aead.Seal(data, data, buffer.Bytes(), nil)
+	mac := hmac.New(sha256.New, k.signKey)
+	mac.Write(data)
+	data = mac.Sum(data)
+	cookieValue := base64.RawURLEncoding.EncodeToString(data)
+	if len(cookieValue) > store.options.MaxSize {
+		return "", ErrCookieTooLarge
+	}
+	return cookieValue, nil
+}
+
+// verify and decrypt cookie value make by Save with any of keys
+func (store *Store) Load(cookieValue string) (sessionId string, wholeValue map[string]interface{}, err error) {
+	if len(cookieValue) > store.options.MaxSize {
+		return "", nil, ErrInvalidCookie
+	}
+	// strict decoding so a changed padding bit is not ignored
+	data, err := base64.RawURLEncoding.Strict().DecodeString(cookieValue)
+	if err != nil || len(data) < sha256.Size {
+		return "", nil, ErrInvalidCookie
+	}
+	data, sign := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	for _, k := range store.keys {
+		mac := hmac.New(sha256.New, k.signKey)
+		mac.Write(data)
+		if !hmac.Equal(mac.Sum(nil), sign) {
+			continue
+		}
+		nonceSize := k.aead.NonceSize()
+		if len(data) < nonceSize {
+			return "", nil, ErrInvalidCookie
+		}
+		plain, err := k.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+		if err != nil {
+			return "", nil, ErrInvalidCookie
+		}
+		p := payload{}
+		if err = gob.NewDecoder(bytes.NewReader(plain)).Decode(&p); err != nil {
+			return "", nil, err
+		}
+		if store.now().UnixNano() >= p.Expires {
+			return "", nil, ErrSessionExpired
+		}
+		if p.Values == nil {
+			p.Values = make(map[string]interface{})
+		}
+		return p.Id, p.Values, nil
+	}
+	return "", nil, ErrInvalidCookie
+}
+
+// generate a sessionId by IDGenerator, it's only used to identify a session because session is store in cookie
+// return empty sessionId if IDGenerator fail
+func (store *Store) NewSession() string {
+	sessionId, _ := store.options.IDGenerator.NewID()
+	return sessionId
+}
+
+// nothing store in server side, cookie will be removed by pong
+func (store *Store) Destory(sessionId string) error {
+	return nil
+}
+
+// return a new sessionId, value will be Save to cookie with new sessionId by pong
+func (store *Store) Reset(oldSessionId string) (string, error) {
+	return store.NewSession(), nil
+}
+
+// session is only Load from cookie, so always return false
+func (store *Store) Has(sessionId string) bool {
+	return false
+}
+
+// session is only Load from cookie, so always return a empty map
+func (store *Store) Read(sessionId string) map[string]interface{} {
+	return make(map[string]interface{})
+}
+
+// value will be Save to cookie by pong before response is send
+func (store *Store) Write(sessionId string, changes map[string]interface{}) error {
+	return nil
+}
+
+// value will be Save to cookie by pong before response is send
+func (store *Store) Delete(sessionId string, names ...string) error {
+	return nil
+}
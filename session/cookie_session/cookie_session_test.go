@@ -0,0 +1,189 @@
+package cookie_session
+
+import (
+	"encoding/gob"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/_test"
+	"github.com/gwuhaolin/pong/pongtest"
+)
+
+var (
+	oldTestKey = []byte("0123456789abcdef-old-key")
+	testKey    = []byte("0123456789abcdef-new-key")
+)
+
+func init() {
+	gob.Register(_test_util.TestUser{})
+}
+
+func mustNew(t *testing.T, options Options, keys ...[]byte) *Store {
+	store, err := NewWithOptions(options, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSaveLoad(t *testing.T) {
+	store := mustNew(t, Options{}, testKey)
+	user := _test_util.TestUser{
+		Name:  "吴浩麟",
+		Age:   23,
+		Money: 123.456,
+		Alive: true,
+		Notes: []_test_util.TestNote{
+			{Text: "明天去放风筝"},
+		},
+	}
+	cookieValue, err := store.Save("sid", map[string]interface{}{"user": user, "age": 23})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(cookieValue, "吴浩麟") {
+		t.Error("cookie should be encrypted")
+	}
+	sid, value, err := store.Load(cookieValue)
+	if err != nil || sid != "sid" || !reflect.DeepEqual(value["user"], user) || value["age"] != 23 {
+		t.Error(sid, value, err)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	store := mustNew(t, Options{}, testKey)
+	cookieValue, _ := store.Save("sid", map[string]interface{}{"admin": false})
+	bs := []byte(cookieValue)
+	for _, i := range []int{0, len(bs) / 2, len(bs) - 1} {
+		tampered := append([]byte{}, bs...)
+		if tampered[i] == 'A' {
+			tampered[i] = 'B'
+		} else {
+			tampered[i] = 'A'
+		}
+		if _, _, err := store.Load(string(tampered)); err != ErrInvalidCookie {
+			t.Error(i, err)
+		}
+	}
+	for _, value := range []string{"", "not base64!", "c2hvcnQ"} {
+		if _, _, err := store.Load(value); err != ErrInvalidCookie {
+			t.Error(value, err)
+		}
+	}
+	other := mustNew(t, Options{}, oldTestKey)
+	if _, _, err := other.Load(cookieValue); err != ErrInvalidCookie {
+		t.Error("cookie make by other key should be invalid", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := mustNew(t, Options{}, oldTestKey)
+	cookieValue, _ := old.Save("sid", map[string]interface{}{"name": "old"})
+	rotated := mustNew(t, Options{}, testKey, oldTestKey)
+	sid, value, err := rotated.Load(cookieValue)
+	if err != nil || sid != "sid" || value["name"] != "old" {
+		t.Error(sid, value, err)
+	}
+	// new cookie is encrypted by first key, so old store can't read it
+	cookieValue, _ = rotated.Save("sid", value)
+	if _, _, err = old.Load(cookieValue); err != ErrInvalidCookie {
+		t.Error(err)
+	}
+	if _, _, err = mustNew(t, Options{}, testKey).Load(cookieValue); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	store := mustNew(t, Options{MaxAge: time.Minute}, testKey)
+	now := time.Now()
+	store.now = func() time.Time {
+		return now
+	}
+	cookieValue, _ := store.Save("sid", map[string]interface{}{})
+	now = now.Add(59 * time.Second)
+	if _, _, err := store.Load(cookieValue); err != nil {
+		t.Error(err)
+	}
+	now = now.Add(time.Second)
+	if _, _, err := store.Load(cookieValue); err != ErrSessionExpired {
+		t.Error(err)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	store := mustNew(t, Options{}, testKey)
+	if _, err := store.Save("sid", map[string]interface{}{"big": strings.Repeat("a", 4096)}); err != ErrCookieTooLarge {
+		t.Error(err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	if _, err := New(); err != ErrInvalidKey {
+		t.Error(err)
+	}
+	if _, err := New(testKey, []byte("short")); err != ErrInvalidKey {
+		t.Error(err)
+	}
+}
+
+func TestSessionWithPong(t *testing.T) {
+	po := pong.New()
+	po.EnableSession(mustNew(t, Options{}, testKey))
+	root := po.Root
+	root.Get("/set", func(c *pong.Context) {
+		if err := c.Session.Set(map[string]interface{}{"name": c.Request.Query("name")}); err != nil {
+			t.Error(err)
+		}
+		c.Response.String("")
+	})
+	root.Get("/big", func(c *pong.Context) {
+		err := c.Session.Set(map[string]interface{}{"name": strings.Repeat("a", 4096)})
+		if err != ErrCookieTooLarge {
+			t.Error(err)
+		}
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	root.Get("/reset", func(c *pong.Context) {
+		if err := c.ResetSession(); err != nil {
+			t.Error(err)
+		}
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	root.Get("/destory", func(c *pong.Context) {
+		if err := c.DestorySession(); err != nil {
+			t.Error(err)
+		}
+		c.Response.String("")
+	})
+	client := pongtest.New(t, po)
+	if cookies := client.Get("/set").Query("name", "吴浩麟").Do().Cookies(); len(cookies) != 1 {
+		t.Fatal(cookies)
+	}
+	first := client.Cookie(pong.SessionCookiesName)
+	// session not change, so no cookie is send
+	res := client.Get("/get").Do().AssertBody("吴浩麟")
+	if cookies := res.Cookies(); len(cookies) != 0 {
+		t.Error(cookies)
+	}
+	client.Get("/big").Do().AssertBody("吴浩麟")
+	client.Get("/reset").Do().AssertBody("吴浩麟")
+	if second := client.Cookie(pong.SessionCookiesName); second == nil || second.Value == first.Value {
+		t.Error("cookie should be update after reset")
+	}
+	client.Get("/get").Do().AssertBody("吴浩麟")
+	client.Get("/destory").Do()
+	if cookie := client.Cookie(pong.SessionCookiesName); cookie != nil {
+		t.Error("cookie should be removed", cookie)
+	}
+	client.Get("/get").Do().AssertBody("")
+	// tampered cookie start a new session
+	client.Get("/get").Cookie(&http.Cookie{Name: pong.SessionCookiesName, Value: first.Value + "x"}).Do().AssertBody("")
+}
@@ -0,0 +1,429 @@
+package file_session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/session/codec"
+)
+
+const (
+	// every session is store in a file named sessionId + sessionFileExt
+	sessionFileExt = ".session"
+	// session is write to a temp file which name start with tempFilePrefix first then rename to session file
+	tempFilePrefix = ".tmp-"
+	// lock file in Dir used to lock the whole store between processes
+	lockFileName = ".lock"
+	// sessionId longer than it will not be accept
+	maxSessionIdLength = 128
+	// max times to retry when a new sessionId has exist
+	maxNewSessionRetry = 10
+)
+
+var (
+	// this error will be return when operate a session which is not exist or has expired
+	ErrSessionNotFound = errors.New("file_session:session not found")
+	// this error will be return when can't generate a sessionId which not exist after retry
+	ErrSessionIdConflict = errors.New("file_session:can't generate unique sessionId")
+	// this error will be return when IDGenerator generate a sessionId can't be used as file name
+	ErrInvalidSessionId = errors.New("file_session:sessionId can only has URL safe base64 chars and dot")
+)
+
+var (
+	_ pong.SessionIO        = (*Store)(nil)
+	_ pong.IDGeneratorOwner = (*Store)(nil)
+)
+
+// Serializer encode a session's whole value to bytes to store in file, and decode it back
+type Serializer interface {
+	Marshal(wholeValue map[string]interface{}) ([]byte, error)
+	Unmarshal(data []byte) (map[string]interface{}, error)
+}
+
+// GobSerializer use encoding/gob to encode session, so value's type is keep
+// value which type is struct should be registered by codec.Register or gob.Register first
+type GobSerializer struct{}
+
+func (GobSerializer) Marshal(wholeValue map[string]interface{}) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	err := gob.NewEncoder(&buffer).Encode(wholeValue)
+	return buffer.Bytes(), err
+}
+
+func (GobSerializer) Unmarshal(data []byte) (wholeValue map[string]interface{}, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&wholeValue)
+	return
+}
+
+// JSONSerializer use encoding/json to encode session, session file is readable
+// but value's type is lost after read, number will be float64 and struct will be map[string]interface{}
+// use CodecSerializer with codec.JSON to keep value's type
+type JSONSerializer struct{}
+
+func (JSONSerializer) Marshal(wholeValue map[string]interface{}) ([]byte, error) {
+	return json.Marshal(wholeValue)
+}
+
+func (JSONSerializer) Unmarshal(data []byte) (wholeValue map[string]interface{}, err error) {
+	err = json.Unmarshal(data, &wholeValue)
+	return
+}
+
+// CodecSerializer use a pong.SessionCodec to encode session's whole value
+// use it with codec.JSON to keep value's type and make session file readable
+type CodecSerializer struct {
+	Codec pong.SessionCodec
+}
+
+func (s CodecSerializer) Marshal(wholeValue map[string]interface{}) ([]byte, error) {
+	return s.Codec.Marshal(wholeValue)
+}
+
+func (s CodecSerializer) Unmarshal(data []byte) (map[string]interface{}, error) {
+	value, err := s.Codec.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	wholeValue, ok := value.(map[string]interface{})
+	if !ok && value != nil {
+		return nil, codec.ErrInvalidData
+	}
+	return wholeValue, nil
+}
+
+// Options config a file session store
+// zero value of every field means use default
+type Options struct {
+	// directory to store session files, it will be created if not exist
+	// default is pong_session in os.TempDir()
+	Dir string
+	// serializer used to encode session to file, default is GobSerializer
+	Serializer Serializer
+	// session not accessed in IdleTimeout will expire, every access will delay it's expiration
+	// default is 30 minutes, negative means never
+	IdleTimeout time.Duration
+	// how often the background janitor remove expired session files
+	// default is 1 minute, negative means no janitor, call Store.GC yourself to remove expired session files
+	GCInterval time.Duration
+	// used to generate sessionId, default is pong.RandomIDGenerator
+	// sessionId is used as file name, so it can only has URL safe base64 chars and dot
+	IDGenerator pong.IDGenerator
+}
+
+// Store is a session store which keep one file per session in Options.Dir
+// session file is replaced by write to a temp file then rename, so a reader never see half write file
+// changes are protected by a lock file in Dir, so more than one process can share the same Dir
+// last access time is the session file's modify time
+type Store struct {
+	options  Options
+	now      func() time.Time
+	lock     sync.Mutex
+	lockFile *os.File
+	stop     chan struct{}
+	stopOnce sync.Once
+	// closed when janitor exit, nil if no janitor
+	janitorDone chan struct{}
+}
+
+// make a file session store with default Options
+func New() (*Store, error) {
+	return NewWithOptions(Options{})
+}
+
+// make a file session store with options
+// if GCInterval is not negative, a background janitor will run, call Store.Close to stop it
+func NewWithOptions(options Options) (*Store, error) {
+	if len(options.Dir) == 0 {
+		options.Dir = filepath.Join(os.TempDir(), "pong_session")
+	}
+	if options.Serializer == nil {
+		options.Serializer = GobSerializer{}
+	}
+	if options.IdleTimeout == 0 {
+		options.IdleTimeout = 30 * time.Minute
+	}
+	if options.GCInterval == 0 {
+		options.GCInterval = time.Minute
+	}
+	if options.IDGenerator == nil {
+		options.IDGenerator = pong.RandomIDGenerator{}
+	}
+	if err := os.MkdirAll(options.Dir, 0700); err != nil {
+		return nil, err
+	}
+	lockFile, err := os.OpenFile(filepath.Join(options.Dir, lockFileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{
+		options:  options,
+		now:      time.Now,
+		lockFile: lockFile,
+		stop:     make(chan struct{}),
+	}
+	if options.GCInterval > 0 {
+		store.janitorDone = make(chan struct{})
+		go store.janitor(options.GCInterval)
+	}
+	return store, nil
+}
+
+// stop the background janitor and release the lock file, Store can't be used after Close
+// Close wait the janitor exit, so a running GC never use the closed lock file
+func (store *Store) Close() error {
+	store.stopOnce.Do(func() {
+		close(store.stop)
+	})
+	if store.janitorDone != nil {
+		<-store.janitorDone
+	}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.lockFile.Close()
+}
+
+func (store *Store) janitor(interval time.Duration) {
+	defer close(store.janitorDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			store.GC()
+		case <-store.stop:
+			return
+		}
+	}
+}
+
+// lock the store for this goroutine and other processes use the same Dir
+func (store *Store) lockStore() {
+	store.lock.Lock()
+	lockFile(store.lockFile)
+}
+
+func (store *Store) unlockStore() {
+	unlockFile(store.lockFile)
+	store.lock.Unlock()
+}
+
+// remove all expired session files and temp files left by crashed process
+func (store *Store) GC() {
+	entries, err := os.ReadDir(store.options.Dir)
+	if err != nil {
+		return
+	}
+	now := store.now()
+	store.lockStore()
+	defer store.unlockStore()
+	for _, entry := range entries {
+		name := entry.Name()
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(store.options.Dir, name)
+		switch {
+		case strings.HasSuffix(name, sessionFileExt):
+			if store.expired(info, now) {
+				os.Remove(path)
+			}
+		case strings.HasPrefix(name, tempFilePrefix):
+			// a temp file should be renamed soon, if it's still here it's left by a crashed process
+			if now.Sub(info.ModTime()) > time.Minute {
+				os.Remove(path)
+			}
+		}
+	}
+}
+
+func (store *Store) expired(info os.FileInfo, now time.Time) bool {
+	return store.options.IdleTimeout > 0 && now.Sub(info.ModTime()) > store.options.IdleTimeout
+}
+
+// sessionId is give by client, only accept URL safe base64 chars and dot so it can't point to a file out of Dir
+func validSessionId(sessionId string) bool {
+	if len(sessionId) == 0 || len(sessionId) > maxSessionIdLength {
+		return false
+	}
+	for _, c := range sessionId {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '=' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// return the IDGenerator used to generate sessionId, pong use it to validate sessionId in cookie
+func (store *Store) IDGenerator() pong.IDGenerator {
+	return store.options.IDGenerator
+}
+
+func (store *Store) path(sessionId string) string {
+	return filepath.Join(store.options.Dir, sessionId+sessionFileExt)
+}
+
+// load a session's whole value, return nil if not exist or has expired
+// access time of session not expired will be update, expired one is left to GC
+func (store *Store) load(sessionId string) map[string]interface{} {
+	if !validSessionId(sessionId) {
+		return nil
+	}
+	path := store.path(sessionId)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	now := store.now()
+	if store.expired(info, now) {
+		return nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil
+	}
+	wholeValue, err := store.options.Serializer.Unmarshal(data)
+	if err != nil {
+		return nil
+	}
+	if wholeValue == nil {
+		wholeValue = make(map[string]interface{})
+	}
+	os.Chtimes(path, now, now)
+	return wholeValue
+}
+
+// write whole value to a temp file then rename it to session file
+func (store *Store) save(sessionId string, wholeValue map[string]interface{}) error {
+	data, err := store.options.Serializer.Marshal(wholeValue)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(store.options.Dir, tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		now := store.now()
+		os.Chtimes(temp.Name(), now, now)
+		err = os.Rename(temp.Name(), store.path(sessionId))
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// make a new session which not exist, must be called with store locked
+func (store *Store) create(wholeValue map[string]interface{}) (string, error) {
+	for i := 0; i < maxNewSessionRetry; i++ {
+		sessionId, err := store.options.IDGenerator.NewID()
+		if err != nil {
+			return "", err
+		}
+		if !validSessionId(sessionId) {
+			return "", ErrInvalidSessionId
+		}
+		if _, err := os.Stat(store.path(sessionId)); !os.IsNotExist(err) {
+			continue
+		}
+		return sessionId, store.save(sessionId, wholeValue)
+	}
+	return "", ErrSessionIdConflict
+}
+
+// make a new empty session file, return empty string if fail
+func (store *Store) NewSession() (sessionId string) {
+	store.lockStore()
+	defer store.unlockStore()
+	sessionId, err := store.create(make(map[string]interface{}))
+	if err != nil {
+		return ""
+	}
+	return sessionId
+}
+
+func (store *Store) Destory(sessionId string) error {
+	if !validSessionId(sessionId) {
+		return nil
+	}
+	store.lockStore()
+	defer store.unlockStore()
+	err := os.Remove(store.path(sessionId))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// move old session's value to a new session file
+func (store *Store) Reset(oldSessionId string) (newSessionId string, err error) {
+	store.lockStore()
+	defer store.unlockStore()
+	wholeValue := store.load(oldSessionId)
+	if wholeValue == nil {
+		return "", ErrSessionNotFound
+	}
+	newSessionId, err = store.create(wholeValue)
+	if err != nil {
+		return "", err
+	}
+	return newSessionId, os.Remove(store.path(oldSessionId))
+}
+
+func (store *Store) Has(sessionId string) bool {
+	return store.Read(sessionId) != nil
+}
+
+// read session file, return nil if not exist or has expired
+// every Read return a new map decode from file, so change it will not affect store
+func (store *Store) Read(sessionId string) (wholeValue map[string]interface{}) {
+	return store.load(sessionId)
+}
+
+func (store *Store) Write(sessionId string, changes map[string]interface{}) error {
+	store.lockStore()
+	defer store.unlockStore()
+	wholeValue := store.load(sessionId)
+	if wholeValue == nil {
+		return ErrSessionNotFound
+	}
+	for k, v := range changes {
+		wholeValue[k] = v
+	}
+	return store.save(sessionId, wholeValue)
+}
+
+func (store *Store) Delete(sessionId string, names ...string) error {
+	store.lockStore()
+	defer store.unlockStore()
+	wholeValue := store.load(sessionId)
+	if wholeValue == nil {
+		return ErrSessionNotFound
+	}
+	for _, name := range names {
+		delete(wholeValue, name)
+	}
+	return store.save(sessionId, wholeValue)
+}
@@ -0,0 +1,217 @@
+package file_session
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/_test"
+	"github.com/gwuhaolin/pong/session/codec"
+	"github.com/gwuhaolin/pong/session/sessiontest"
+)
+
+func init() {
+	gob.Register(_test_util.TestUser{})
+}
+
+func newTestStore(t *testing.T, options Options) *Store {
+	if len(options.Dir) == 0 {
+		options.Dir = t.TempDir()
+	}
+	if options.GCInterval == 0 {
+		options.GCInterval = -1
+	}
+	store, err := NewWithOptions(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store
+}
+
+func TestSuite(t *testing.T) {
+	t.Run("Gob", func(t *testing.T) {
+		sessiontest.Run(t, func() pong.SessionIO {
+			return newTestStore(t, Options{})
+		})
+	})
+	t.Run("JSON", func(t *testing.T) {
+		sessiontest.Run(t, func() pong.SessionIO {
+			return newTestStore(t, Options{Serializer: JSONSerializer{}})
+		})
+	})
+	t.Run("SignedID", func(t *testing.T) {
+		sessiontest.Run(t, func() pong.SessionIO {
+			return newTestStore(t, Options{IDGenerator: pong.SignedIDGenerator{Keys: [][]byte{[]byte("key")}}})
+		})
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	serializers := map[string]Serializer{
+		"Gob":     GobSerializer{},
+		"JSON":    CodecSerializer{Codec: codec.JSON{}},
+		"MsgPack": CodecSerializer{Codec: codec.MsgPack{}},
+	}
+	for name, serializer := range serializers {
+		t.Run(name, func(t *testing.T) {
+			sessiontest.RunRoundTrip(t, func() pong.SessionIO {
+				return newTestStore(t, Options{Serializer: serializer})
+			})
+		})
+	}
+}
+
+func TestGobKeepType(t *testing.T) {
+	store := newTestStore(t, Options{})
+	user := _test_util.TestUser{
+		Name:  "吴浩麟",
+		Age:   23,
+		Money: 123.456,
+		Alive: true,
+		Notes: []_test_util.TestNote{
+			{Text: "明天去放风筝"},
+		},
+	}
+	sid := store.NewSession()
+	if err := store.Write(sid, map[string]interface{}{"user": user, "age": 23}); err != nil {
+		t.Fatal(err)
+	}
+	value := store.Read(sid)
+	if !reflect.DeepEqual(value["user"], user) || value["age"] != 23 {
+		t.Error(value)
+	}
+}
+
+func TestPersistAcrossStore(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, Options{Dir: dir})
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟"})
+	store.Close()
+	// like process restart
+	reopen := newTestStore(t, Options{Dir: dir})
+	if value := reopen.Read(sid); value["name"] != "吴浩麟" {
+		t.Error(value)
+	}
+}
+
+func TestInvalidSessionId(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, Options{Dir: filepath.Join(dir, "sessions")})
+	secret := filepath.Join(dir, "secret"+sessionFileExt)
+	os.WriteFile(secret, []byte("secret"), 0600)
+	for _, sid := range []string{"", "../secret", "a/b", "a.b", string(make([]byte, maxSessionIdLength+1))} {
+		if store.Has(sid) || store.Read(sid) != nil {
+			t.Error(sid)
+		}
+		if store.Write(sid, map[string]interface{}{"name": "吴浩麟"}) != ErrSessionNotFound {
+			t.Error(sid)
+		}
+		store.Destory(sid)
+	}
+	if _, err := os.Stat(secret); err != nil {
+		t.Error("file out of Dir should not be touch", err)
+	}
+}
+
+func TestExpireAndGC(t *testing.T) {
+	store := newTestStore(t, Options{IdleTimeout: time.Minute})
+	now := time.Now()
+	store.now = func() time.Time {
+		return now
+	}
+	idle := store.NewSession()
+	active := store.NewSession()
+	now = now.Add(50 * time.Second)
+	if !store.Has(active) {
+		t.Fatal("session should not expire")
+	}
+	now = now.Add(20 * time.Second)
+	if store.Has(idle) || !store.Has(active) {
+		t.Error("idle session should expire and access should delay expiration")
+	}
+	if err := store.Write(idle, map[string]interface{}{"name": "吴浩麟"}); err != ErrSessionNotFound {
+		t.Error(err)
+	}
+	// temp file left by crashed process
+	temp := filepath.Join(store.options.Dir, tempFilePrefix+"crashed")
+	os.WriteFile(temp, nil, 0600)
+	os.Chtimes(temp, now.Add(-2*time.Minute), now.Add(-2*time.Minute))
+	store.GC()
+	if _, err := os.Stat(store.path(idle)); !os.IsNotExist(err) {
+		t.Error("expired session file should be removed by GC")
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Error("stale temp file should be removed by GC")
+	}
+	if !store.Has(active) {
+		t.Error("active session should not be removed by GC")
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	store := newTestStore(t, Options{IdleTimeout: time.Millisecond, GCInterval: 5 * time.Millisecond})
+	sid := store.NewSession()
+	path := store.path(sid)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("janitor should remove expired session file")
+}
+
+func TestCloseStopJanitor(t *testing.T) {
+	store := newTestStore(t, Options{IdleTimeout: time.Minute, GCInterval: time.Millisecond})
+	sid := store.NewSession()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// janitor has exit when Close return, expired session file is keep
+	path := store.path(sid)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path, old, old)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := os.Stat(path); err != nil {
+		t.Error("janitor should stop after Close", err)
+	}
+}
+
+// two stores share the same Dir like two processes, changes should not be lost
+func TestConcurrentWrite(t *testing.T) {
+	dir := t.TempDir()
+	stores := []*Store{newTestStore(t, Options{Dir: dir}), newTestStore(t, Options{Dir: dir})}
+	sid := stores[0].NewSession()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprint("key", i)
+			if err := stores[i%2].Write(sid, map[string]interface{}{key: i}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if value := stores[1].Read(sid); len(value) != 40 {
+		t.Error(len(value), value)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if name := entry.Name(); name != lockFileName && filepath.Ext(name) != sessionFileExt {
+			t.Error("temp file should not be left", name)
+		}
+	}
+}
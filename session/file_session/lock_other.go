@@ -0,0 +1,17 @@
+//go:build !unix
+
+package file_session
+
+import (
+	"os"
+)
+
+// file lock is not support on this platform, store is only locked in this process
+// so don't share the same Dir between processes
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package file_session
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock file by flock, block until get the lock
+func lockFile(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -1,60 +1,619 @@
 package memory_session
 
 import (
-	"io"
-	"encoding/base64"
-	"crypto/rand"
+	"container/list"
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/gwuhaolin/pong"
 )
 
-//in memory sessionManager
-type memorySessionManager struct {
-	pong.SessionIO
-	store map[string]map[string]interface{}
+var (
+	_ pong.SessionIO        = (*Store)(nil)
+	_ pong.IDGeneratorOwner = (*Store)(nil)
+	_ pong.SessionLocker    = (*Store)(nil)
+	_ pong.SessionAdmin     = (*Store)(nil)
+	_ pong.SessionUserIndex = (*Store)(nil)
+)
+
+// max times to retry when a new sessionId has exist
+const maxNewSessionRetry = 10
+
+var (
+	// this error will be return when write to a session which is not exist or has expired
+	ErrSessionNotFound = errors.New("memory_session:session not found")
+	// this error will be return by Reset when can't generate a sessionId which not exist after retry
+	ErrSessionIdConflict = errors.New("memory_session:can't generate unique sessionId")
+)
+
+// Options config a memory session store
+// zero value of every field means use default
+type Options struct {
+	// session not accessed in IdleTimeout will expire, every access will delay it's expiration
+	// default is 30 minutes, negative means never
+	IdleTimeout time.Duration
+	// session will expire after AbsoluteTimeout since it's created, no matter it's accessed or not
+	// default is 24 hours, negative means never
+	AbsoluteTimeout time.Duration
+	// how often the background janitor remove expired sessions
+	// default is 1 minute, negative means no janitor, expired session is only removed when it's accessed
+	GCInterval time.Duration
+	// max session count in store, when reach it the least recently used session will be evicted
+	// LRU order is kept in each shard, use Shards 1 if you want strict LRU
+	// default 0 means no limit
+	MaxSessions int
+	// sessions are split to Shards parts, each part has it's own lock, default is 16
+	Shards int
+	// used to generate sessionId, default is pong.RandomIDGenerator
+	IDGenerator pong.IDGenerator
+	// session's lock is released after LockTTL even it's not unlocked, so a stuck request can't hold it forever
+	// default is 30 seconds, negative means never, it should be longer than your longest request
+	LockTTL time.Duration
+}
+
+type entry struct {
+	id       string
+	values   map[string]interface{}
+	created  time.Time
+	accessed time.Time
+	// metadata used by SessionAdmin
+	userId    string
+	ip        string
+	userAgent string
+}
+
+// lock of a session, refs count goroutines hold or wait it, it's removed from Store.locks when refs is 0
+type sessionLock struct {
+	// a buffered channel with capacity 1 works as mutex which can be wait with ctx
+	ch   chan struct{}
+	refs int
+}
+
+type shard struct {
+	lock     sync.Mutex
+	sessions map[string]*list.Element
+	// front is the most recently used
+	lru *list.List
+}
+
+// Store is an in memory session store which is safe for concurrent use
+// sessions expire by IdleTimeout and AbsoluteTimeout, a background janitor remove expired sessions
+type Store struct {
+	options  Options
+	shards   []*shard
+	count    int64
+	now      func() time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+	// per session locks used by Lock
+	locksLock sync.Mutex
+	locks     map[string]*sessionLock
+	// sessionIds tag with each user id, used by ListUser and RevokeUser
+	usersLock sync.Mutex
+	users     map[string]map[string]bool
+}
+
+// make an in memory session store with default Options
+func New() *Store {
+	return NewWithOptions(Options{})
+}
+
+// make an in memory session store with options
+// if GCInterval is not negative, a background janitor will run, call Store.Stop to stop it
+func NewWithOptions(options Options) *Store {
+	if options.IdleTimeout == 0 {
+		options.IdleTimeout = 30 * time.Minute
+	}
+	if options.AbsoluteTimeout == 0 {
+		options.AbsoluteTimeout = 24 * time.Hour
+	}
+	if options.GCInterval == 0 {
+		options.GCInterval = time.Minute
+	}
+	if options.Shards <= 0 {
+		options.Shards = 16
+	}
+	if options.IDGenerator == nil {
+		options.IDGenerator = pong.RandomIDGenerator{}
+	}
+	if options.LockTTL == 0 {
+		options.LockTTL = 30 * time.Second
+	}
+	store := &Store{
+		options: options,
+		shards:  make([]*shard, options.Shards),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		locks:   make(map[string]*sessionLock),
+		users:   make(map[string]map[string]bool),
+	}
+	for i := range store.shards {
+		store.shards[i] = &shard{
+			sessions: make(map[string]*list.Element),
+			lru:      list.New(),
+		}
+	}
+	if options.GCInterval > 0 {
+		go store.janitor(options.GCInterval)
+	}
+	return store
+}
+
+// stop the background janitor, Store can still be used after Stop
+func (store *Store) Stop() {
+	store.stopOnce.Do(func() {
+		close(store.stop)
+	})
+}
+
+// return how many sessions in store, include expired but not removed
+func (store *Store) Len() int {
+	return int(atomic.LoadInt64(&store.count))
+}
+
+func (store *Store) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			store.GC()
+		case <-store.stop:
+			return
+		}
+	}
+}
+
+// remove all expired sessions
+func (store *Store) GC() {
+	now := store.now()
+	for _, s := range store.shards {
+		s.lock.Lock()
+		for element := s.lru.Back(); element != nil; {
+			prev := element.Prev()
+			if store.expired(element.Value.(*entry), now) {
+				store.remove(s, element)
+			}
+			element = prev
+		}
+		s.lock.Unlock()
+	}
+}
+
+func (store *Store) shard(sessionId string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(sessionId))
+	return store.shards[h.Sum32()%uint32(len(store.shards))]
+}
+
+func (store *Store) expired(e *entry, now time.Time) bool {
+	if store.options.IdleTimeout > 0 && now.Sub(e.accessed) > store.options.IdleTimeout {
+		return true
+	}
+	if store.options.AbsoluteTimeout > 0 && now.Sub(e.created) > store.options.AbsoluteTimeout {
+		return true
+	}
+	return false
+}
+
+// remove must be called with s.lock held
+func (store *Store) remove(s *shard, element *list.Element) {
+	e := element.Value.(*entry)
+	s.lru.Remove(element)
+	delete(s.sessions, e.id)
+	store.index(e.id, e.userId, "")
+	atomic.AddInt64(&store.count, -1)
+}
+
+// move sessionId from oldUserId's index to newUserId's, empty user id means not indexed
+// it's called with the session's shard lock held
+func (store *Store) index(sessionId string, oldUserId string, newUserId string) {
+	if oldUserId == newUserId {
+		return
+	}
+	store.usersLock.Lock()
+	defer store.usersLock.Unlock()
+	if ids := store.users[oldUserId]; ids != nil {
+		delete(ids, sessionId)
+		if len(ids) == 0 {
+			delete(store.users, oldUserId)
+		}
+	}
+	if len(newUserId) > 0 {
+		ids := store.users[newUserId]
+		if ids == nil {
+			ids = make(map[string]bool)
+			store.users[newUserId] = ids
+		}
+		ids[sessionId] = true
+	}
+}
+
+// return sessionIds tag with userId
+func (store *Store) sessionsOf(userId string) []string {
+	store.usersLock.Lock()
+	defer store.usersLock.Unlock()
+	ids := make([]string, 0, len(store.users[userId]))
+	for id := range store.users[userId] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// get must be called with s.lock held
+// return nil if not exist or has expired, else mark it as recently used
+func (store *Store) get(s *shard, sessionId string) *entry {
+	element := s.sessions[sessionId]
+	if element == nil {
+		return nil
+	}
+	e := element.Value.(*entry)
+	now := store.now()
+	if store.expired(e, now) {
+		store.remove(s, element)
+		return nil
+	}
+	e.accessed = now
+	s.lru.MoveToFront(element)
+	return e
+}
+
+// insert a session, return false if sessionId has exist
+func (store *Store) insert(e *entry) bool {
+	s := store.shard(e.id)
+	s.lock.Lock()
+	if store.get(s, e.id) != nil {
+		s.lock.Unlock()
+		return false
+	}
+	s.sessions[e.id] = s.lru.PushFront(e)
+	s.lock.Unlock()
+	count := atomic.AddInt64(&store.count, 1)
+	if max := int64(store.options.MaxSessions); max > 0 && count > max {
+		store.evict(s, e.id)
+	}
+	return true
 }
 
-func New() pong.SessionIO {
-	return &memorySessionManager{
-		store:make(map[string]map[string]interface{}),
+// evict least recently used sessions until count not over MaxSessions
+// prefer sessions in shard s, never evict the session just inserted
+func (store *Store) evict(s *shard, keepId string) {
+	max := int64(store.options.MaxSessions)
+	candidates := append([]*shard{s}, store.shards...)
+	for _, c := range candidates {
+		c.lock.Lock()
+		for element := c.lru.Back(); element != nil && atomic.LoadInt64(&store.count) > max; {
+			prev := element.Prev()
+			if element.Value.(*entry).id != keepId {
+				store.remove(c, element)
+			}
+			element = prev
+		}
+		c.lock.Unlock()
+		if atomic.LoadInt64(&store.count) <= max {
+			return
+		}
 	}
 }
 
-func (manager *memorySessionManager) NewSession() (sessionId string) {
-	bs := make([]byte, 8)
-	io.ReadFull(rand.Reader, bs)
-	sessionId = base64.URLEncoding.EncodeToString(bs)
-	if manager.Has(sessionId) {
-		return manager.NewSession()
+// return the IDGenerator used to generate sessionId, pong use it to validate sessionId in cookie
+func (store *Store) IDGenerator() pong.IDGenerator {
+	return store.options.IDGenerator
+}
+
+// make a new empty session, return empty sessionId if IDGenerator fail or can't generate a sessionId not exist after retry
+func (store *Store) NewSession() (sessionId string) {
+	for i := 0; i < maxNewSessionRetry; i++ {
+		sessionId, err := store.options.IDGenerator.NewID()
+		if err != nil {
+			return ""
+		}
+		now := store.now()
+		if store.insert(&entry{
+			id:       sessionId,
+			values:   make(map[string]interface{}),
+			created:  now,
+			accessed: now,
+		}) {
+			return sessionId
+		}
 	}
-	manager.store[sessionId] = make(map[string]interface{})
-	return sessionId
+	return ""
 }
 
-func (manager *memorySessionManager) Destory(sessionId string) error {
-	delete(manager.store, sessionId)
+func (store *Store) Destory(sessionId string) error {
+	s := store.shard(sessionId)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if element := s.sessions[sessionId]; element != nil {
+		store.remove(s, element)
+	}
 	return nil
 }
 
-func (manager *memorySessionManager) Reset(oldSessionId string) (newSessionId string, err error) {
-	newSessionId = manager.NewSession()
-	manager.store[newSessionId] = manager.store[oldSessionId]
-	delete(manager.store, oldSessionId)
-	return
+// move old session's value to a new sessionId, created time is keep so AbsoluteTimeout can't be extended by Reset
+// user id tag by Tag is also keep
+// new session is insert and old one is removed under both shards' lock, so the session is never lost or exist twice
+func (store *Store) Reset(oldSessionId string) (newSessionId string, err error) {
+	for i := 0; i < maxNewSessionRetry; i++ {
+		newSessionId, err = store.options.IDGenerator.NewID()
+		if err != nil {
+			return "", err
+		}
+		s, n := store.shard(oldSessionId), store.shard(newSessionId)
+		unlock := store.lockShards(s, n)
+		old := store.get(s, oldSessionId)
+		if old == nil {
+			unlock()
+			return "", ErrSessionNotFound
+		}
+		if store.get(n, newSessionId) != nil {
+			unlock()
+			continue
+		}
+		e := &entry{
+			id:        newSessionId,
+			values:    old.values,
+			created:   old.created,
+			accessed:  store.now(),
+			userId:    old.userId,
+			ip:        old.ip,
+			userAgent: old.userAgent,
+		}
+		n.sessions[newSessionId] = n.lru.PushFront(e)
+		atomic.AddInt64(&store.count, 1)
+		// keep it in user's index, so revoke by user still find it
+		store.index(newSessionId, "", e.userId)
+		store.remove(s, s.sessions[oldSessionId])
+		unlock()
+		return newSessionId, nil
+	}
+	return "", ErrSessionIdConflict
 }
 
-func (manager *memorySessionManager) Has(sessionId string) bool {
-	return manager.store[sessionId] != nil
+// lock shards a and b in the same order as they are in store.shards to avoid deadlock, return a function to unlock them
+func (store *Store) lockShards(a *shard, b *shard) (unlock func()) {
+	if a == b {
+		a.lock.Lock()
+		return a.lock.Unlock
+	}
+	for _, s := range store.shards {
+		if s == b {
+			a, b = b, a
+			break
+		}
+		if s == a {
+			break
+		}
+	}
+	a.lock.Lock()
+	b.lock.Lock()
+	return func() {
+		b.lock.Unlock()
+		a.lock.Unlock()
+	}
 }
 
-func (manager *memorySessionManager) Read(sessionId string) (wholeValue map[string]interface{}) {
-	wholeValue = manager.store[sessionId]
+func (store *Store) Has(sessionId string) bool {
+	s := store.shard(sessionId)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return store.get(s, sessionId) != nil
+}
+
+// return a copy of session's value, so change it will not affect store
+func (store *Store) Read(sessionId string) (wholeValue map[string]interface{}) {
+	s := store.shard(sessionId)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e := store.get(s, sessionId)
+	if e == nil {
+		return nil
+	}
+	wholeValue = make(map[string]interface{}, len(e.values))
+	for k, v := range e.values {
+		wholeValue[k] = v
+	}
 	return
 }
 
-func (manager *memorySessionManager) Write(sessionId string, changes map[string]interface{}) error {
-	sessionValue := manager.store[sessionId]
+func (store *Store) Write(sessionId string, changes map[string]interface{}) error {
+	s := store.shard(sessionId)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e := store.get(s, sessionId)
+	if e == nil {
+		return ErrSessionNotFound
+	}
 	for k, v := range changes {
-		sessionValue[k] = v
+		e.values[k] = v
+	}
+	return nil
+}
+
+func (store *Store) Delete(sessionId string, names ...string) error {
+	s := store.shard(sessionId)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e := store.get(s, sessionId)
+	if e == nil {
+		return ErrSessionNotFound
+	}
+	for _, name := range names {
+		delete(e.values, name)
+	}
+	return nil
+}
+
+// lock session by sessionId in this process, block until lock is acquired or ctx is done
+// the lock only works for one Store in one process, use redis_session to lock across processes
+// the lock is released after Options.LockTTL if it's not unlocked, unlock after that do nothing
+func (store *Store) Lock(ctx context.Context, sessionId string) (unlock func(), err error) {
+	store.locksLock.Lock()
+	l := store.locks[sessionId]
+	if l == nil {
+		l = &sessionLock{ch: make(chan struct{}, 1)}
+		store.locks[sessionId] = l
+	}
+	l.refs++
+	store.locksLock.Unlock()
+	select {
+	case l.ch <- struct{}{}:
+		once := sync.Once{}
+		release := func() {
+			once.Do(func() {
+				<-l.ch
+				store.unref(sessionId, l)
+			})
+		}
+		if store.options.LockTTL < 0 {
+			return release, nil
+		}
+		expire := time.AfterFunc(store.options.LockTTL, release)
+		return func() {
+			expire.Stop()
+			release()
+		}, nil
+	case <-ctx.Done():
+		store.unref(sessionId, l)
+		return nil, ctx.Err()
+	}
+}
+
+func (store *Store) unref(sessionId string, l *sessionLock) {
+	store.locksLock.Lock()
+	defer store.locksLock.Unlock()
+	if l.refs--; l.refs == 0 {
+		delete(store.locks, sessionId)
+	}
+}
+
+func (e *entry) info() pong.SessionInfo {
+	return pong.SessionInfo{
+		ID:        e.id,
+		UserID:    e.userId,
+		Created:   e.created,
+		LastSeen:  e.accessed,
+		IP:        e.ip,
+		UserAgent: e.userAgent,
+	}
+}
+
+// call fn with every session not expired, expired sessions are removed
+// fn is called with shard's lock held
+func (store *Store) each(fn func(s *shard, element *list.Element)) {
+	now := store.now()
+	for _, s := range store.shards {
+		s.lock.Lock()
+		for element := s.lru.Front(); element != nil; {
+			next := element.Next()
+			if store.expired(element.Value.(*entry), now) {
+				store.remove(s, element)
+			} else {
+				fn(s, element)
+			}
+			element = next
+		}
+		s.lock.Unlock()
+	}
+}
+
+// return metadata of all sessions not expired, list sessions doesn't change their last seen time
+func (store *Store) List(ctx context.Context) ([]pong.SessionInfo, error) {
+	infos := make([]pong.SessionInfo, 0, store.Len())
+	store.each(func(s *shard, element *list.Element) {
+		infos = append(infos, element.Value.(*entry).info())
+	})
+	return infos, ctx.Err()
+}
+
+func (store *Store) Count(ctx context.Context) (int, error) {
+	count := 0
+	store.each(func(s *shard, element *list.Element) {
+		count++
+	})
+	return count, ctx.Err()
+}
+
+func (store *Store) Info(ctx context.Context, sessionId string) (*pong.SessionInfo, error) {
+	s := store.shard(sessionId)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	element := s.sessions[sessionId]
+	if element == nil || store.expired(element.Value.(*entry), store.now()) {
+		return nil, ctx.Err()
+	}
+	info := element.Value.(*entry).info()
+	return &info, ctx.Err()
+}
+
+func (store *Store) Revoke(ctx context.Context, match func(pong.SessionInfo) bool) (int, error) {
+	revoked := 0
+	store.each(func(s *shard, element *list.Element) {
+		if match(element.Value.(*entry).info()) {
+			store.remove(s, element)
+			revoked++
+		}
+	})
+	return revoked, ctx.Err()
+}
+
+func (store *Store) Tag(ctx context.Context, sessionId string, userId string) error {
+	s := store.shard(sessionId)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e := store.get(s, sessionId)
+	if e == nil {
+		return ErrSessionNotFound
+	}
+	store.index(sessionId, e.userId, userId)
+	e.userId = userId
+	return nil
+}
+
+// return metadata of sessions tag with userId by index, list sessions doesn't change their last seen time
+func (store *Store) ListUser(ctx context.Context, userId string) ([]pong.SessionInfo, error) {
+	infos := []pong.SessionInfo{}
+	now := store.now()
+	for _, id := range store.sessionsOf(userId) {
+		s := store.shard(id)
+		s.lock.Lock()
+		if element := s.sessions[id]; element != nil && !store.expired(element.Value.(*entry), now) {
+			infos = append(infos, element.Value.(*entry).info())
+		}
+		s.lock.Unlock()
+	}
+	return infos, ctx.Err()
+}
+
+// remove sessions tag with userId by index
+func (store *Store) RevokeUser(ctx context.Context, userId string) (int, error) {
+	revoked := 0
+	now := store.now()
+	for _, id := range store.sessionsOf(userId) {
+		s := store.shard(id)
+		s.lock.Lock()
+		if element := s.sessions[id]; element != nil && element.Value.(*entry).userId == userId {
+			if !store.expired(element.Value.(*entry), now) {
+				revoked++
+			}
+			store.remove(s, element)
+		}
+		s.lock.Unlock()
+	}
+	return revoked, ctx.Err()
+}
+
+func (store *Store) Touch(ctx context.Context, sessionId string, ip string, userAgent string) error {
+	s := store.shard(sessionId)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e := store.get(s, sessionId); e != nil {
+		e.ip, e.userAgent = ip, userAgent
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,260 @@
+package memory_session
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/session/sessiontest"
+)
+
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) Add(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+func newTestStore(options Options) (*Store, *fakeClock) {
+	options.GCInterval = -1
+	store := NewWithOptions(options)
+	clock := &fakeClock{now: time.Now()}
+	store.now = clock.Now
+	return store, clock
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	store := New()
+	defer store.Stop()
+	sid := store.NewSession()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := strconv.Itoa(i)
+			store.Write(sid, map[string]interface{}{key: i})
+			store.Read(sid)
+			store.Has(sid)
+			other := store.NewSession()
+			store.Write(other, map[string]interface{}{"i": i})
+			store.Destory(other)
+		}(i)
+	}
+	wg.Wait()
+	if value := store.Read(sid); len(value) != 50 {
+		t.Error(len(value))
+	}
+	if store.Len() != 1 {
+		t.Error(store.Len())
+	}
+}
+
+func TestReadReturnCopy(t *testing.T) {
+	store, _ := newTestStore(Options{})
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "hal"})
+	store.Read(sid)["name"] = "changed"
+	if store.Read(sid)["name"] != "hal" {
+		t.Error(store.Read(sid))
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	store, clock := newTestStore(Options{IdleTimeout: time.Minute})
+	sid := store.NewSession()
+	clock.Add(50 * time.Second)
+	if !store.Has(sid) {
+		t.Error("session should not expire")
+	}
+	// sliding expiration, last Has delay expiration
+	clock.Add(50 * time.Second)
+	if !store.Has(sid) {
+		t.Error("access should delay expiration")
+	}
+	clock.Add(61 * time.Second)
+	if store.Has(sid) || store.Read(sid) != nil {
+		t.Error("session should expire")
+	}
+	if store.Write(sid, map[string]interface{}{"a": 1}) != ErrSessionNotFound {
+		t.Error("write expired session should fail")
+	}
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	store, clock := newTestStore(Options{IdleTimeout: time.Minute, AbsoluteTimeout: 2 * time.Minute})
+	sid := store.NewSession()
+	for i := 0; i < 3; i++ {
+		clock.Add(30 * time.Second)
+		if !store.Has(sid) {
+			t.Error("session should not expire")
+		}
+	}
+	newSid, err := store.Reset(sid)
+	if err != nil {
+		t.Error(err)
+	}
+	clock.Add(31 * time.Second)
+	if store.Has(newSid) {
+		t.Error("session should expire even it's accessed or reset")
+	}
+}
+
+func TestGC(t *testing.T) {
+	store, clock := newTestStore(Options{IdleTimeout: time.Minute})
+	for i := 0; i < 10; i++ {
+		store.NewSession()
+	}
+	clock.Add(30 * time.Second)
+	alive := store.NewSession()
+	clock.Add(31 * time.Second)
+	store.GC()
+	if store.Len() != 1 || !store.Has(alive) {
+		t.Error(store.Len())
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	store := NewWithOptions(Options{IdleTimeout: time.Millisecond, GCInterval: 5 * time.Millisecond})
+	defer store.Stop()
+	store.NewSession()
+	deadline := time.Now().Add(time.Second)
+	for store.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("janitor should remove expired session")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	store.Stop()
+	store.Stop()
+}
+
+func TestMaxSessions(t *testing.T) {
+	store, clock := newTestStore(Options{MaxSessions: 3, Shards: 1})
+	sids := make([]string, 4)
+	for i := 0; i < 3; i++ {
+		sids[i] = store.NewSession()
+		clock.Add(time.Second)
+	}
+	// make sids[0] recently used, so sids[1] is the least recently used
+	store.Has(sids[0])
+	sids[3] = store.NewSession()
+	if store.Len() != 3 {
+		t.Error(store.Len())
+	}
+	if store.Has(sids[1]) {
+		t.Error("least recently used session should be evicted")
+	}
+	for _, sid := range []string{sids[0], sids[2], sids[3]} {
+		if !store.Has(sid) {
+			t.Error(sid)
+		}
+	}
+}
+
+func TestSuite(t *testing.T) {
+	sessiontest.Run(t, func() pong.SessionIO {
+		return NewWithOptions(Options{GCInterval: -1})
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	sessiontest.RunRoundTrip(t, func() pong.SessionIO {
+		return NewWithOptions(Options{GCInterval: -1})
+	})
+}
+
+// generate ids in order, then fail
+type fakeIDGenerator struct {
+	ids []string
+}
+
+func (g *fakeIDGenerator) NewID() (string, error) {
+	if len(g.ids) == 0 {
+		return "", errors.New("no more id")
+	}
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+func (g *fakeIDGenerator) Valid(id string) bool {
+	return true
+}
+
+func TestIDGenerator(t *testing.T) {
+	store := NewWithOptions(Options{GCInterval: -1})
+	sid := store.NewSession()
+	if !(pong.RandomIDGenerator{}).Valid(sid) || store.IDGenerator() == nil {
+		t.Error("default sessionId should be make by RandomIDGenerator", sid)
+	}
+	store = NewWithOptions(Options{GCInterval: -1, IDGenerator: &fakeIDGenerator{ids: []string{"a", "a", "b"}}})
+	if sid := store.NewSession(); sid != "a" {
+		t.Error(sid)
+	}
+	// retry when sessionId has exist
+	if sid := store.NewSession(); sid != "b" {
+		t.Error(sid)
+	}
+	// IDGenerator fail
+	if sid := store.NewSession(); sid != "" {
+		t.Error(sid)
+	}
+}
+
+func TestResetNotClobber(t *testing.T) {
+	store := NewWithOptions(Options{GCInterval: -1, IDGenerator: &fakeIDGenerator{ids: []string{"other", "mine", "other", "fresh", "unused"}}})
+	store.Write(store.NewSession(), map[string]interface{}{"name": "other"})
+	store.Write(store.NewSession(), map[string]interface{}{"name": "mine"})
+	newSid, err := store.Reset("mine")
+	if err != nil || newSid != "fresh" {
+		t.Fatal(newSid, err)
+	}
+	if store.Read("other")["name"] != "other" || store.Read("fresh")["name"] != "mine" || store.Has("mine") || store.Len() != 2 {
+		t.Error("Reset should move session to a sessionId not exist")
+	}
+	if _, err := store.Reset("no-this"); err != ErrSessionNotFound {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentReset(t *testing.T) {
+	store := NewWithOptions(Options{GCInterval: -1, Shards: 4})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sid := store.NewSession()
+			store.Write(sid, map[string]interface{}{"n": 1})
+			for j := 0; j < 100; j++ {
+				newSid, err := store.Reset(sid)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				sid = newSid
+			}
+			if store.Read(sid)["n"] != 1 {
+				t.Error("session value should be keep after Reset")
+			}
+		}()
+	}
+	wg.Wait()
+	if store.Len() != 8 {
+		t.Error(store.Len())
+	}
+}
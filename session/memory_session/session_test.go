@@ -1,62 +1,57 @@
 package memory_session
 
 import (
+	"context"
+	"errors"
+	"math"
 	"net/http"
-	"net/http/cookiejar"
-	"net/url"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
 	"github.com/gwuhaolin/pong"
 	"github.com/gwuhaolin/pong/_test"
-	"fmt"
-	"strconv"
+	"github.com/gwuhaolin/pong/pongtest"
 )
 
-func runPong() (po *pong.Pong, baseURL string) {
-	po = pong.New()
-	po.Root.Middleware(func(c *pong.Context) {
-		req := c.Request.HTTPRequest
-		fmt.Println(req.Method, req.Host, req.RequestURI)
-	})
-	serverHasRun := make(chan bool)
-	go func() {
-		listenAddr := "127.0.0.1:" + strconv.Itoa(_test_util.ListenPort)
-		baseURL = "http://" + listenAddr
-		serverHasRun <- true
-		http.ListenAndServe(listenAddr, po)
-	}()
-	<-serverHasRun
-	_test_util.ListenPort++
-	return
-}
-
 var sessionManager = New()
 
 func TestNoSession(t *testing.T) {
-	po, baseURL := runPong()
+	po := pong.New()
 	po.EnableSession(sessionManager)
-	root := po.Root
-	root.Get("/hi", func(c *pong.Context) {
+	po.Root.Get("/hi", func(c *pong.Context) {
 		c.Response.String("")
 	})
-	defer func() {
-		res, err := http.Get(baseURL + "/hi")
-		if err != nil {
-			t.Error(err)
-		} else {
-			cookies := res.Cookies()
-			if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
-				t.Error(cookies)
-			}
-			t.Log(`TestHasSession`)
-		}
-	}()
+	po.Root.Get("/set", func(c *pong.Context) {
+		c.Session.Set(map[string]interface{}{"name": "吴浩麟"})
+		c.Response.String("")
+	})
+	po.Root.Get("/clear", func(c *pong.Context) {
+		c.Session.Delete("missing")
+		c.Session.Clear()
+		c.Response.String("")
+	})
+	client := pongtest.New(t, po)
+	// session is not touched, no cookie is set
+	if cookies := client.Get("/hi").Do().Cookies(); len(cookies) != 0 {
+		t.Error(cookies)
+	}
+	// delete nothing from a new session, no cookie is set
+	if cookies := client.Get("/clear").Do().Cookies(); len(cookies) != 0 {
+		t.Error(cookies)
+	}
+	cookies := client.Get("/set").Do().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
+		t.Error(cookies)
+	}
 }
 
 func TestHasSession(t *testing.T) {
-	po, baseURL := runPong()
+	po := pong.New()
 	po.EnableSession(sessionManager)
-	root := po.Root
 	user := _test_util.TestUser{
 		Name:  "吴浩麟",
 		Age:   23,
@@ -67,88 +62,63 @@ func TestHasSession(t *testing.T) {
 			{Text: "今天我们去逛宜家啦"},
 		},
 	}
-	root.Get("/hi", func(c *pong.Context) {
+	po.Root.Get("/hi", func(c *pong.Context) {
 		sUser := c.Session.Get("user")
 		if !reflect.DeepEqual(sUser, user) {
 			t.Error(sUser)
 		}
-		t.Log(`TestHasSession`)
-	})
-	defer func() {
-		sid := sessionManager.NewSession()
-		sessionManager.Write(sid, map[string]interface{}{"user": user})
-		jar, _ := cookiejar.New(nil)
-		url, _ := url.Parse(baseURL + "/hi")
-		jar.SetCookies(url, []*http.Cookie{&http.Cookie{Name: pong.SessionCookiesName, Value: sid}})
-		client := http.Client{
-			Jar: jar,
-		}
-		_, err := client.Get(url.String())
-		if err != nil {
-			t.Error(err)
-		}
-	}()
+		c.Response.String("")
+	})
+	sid := sessionManager.NewSession()
+	sessionManager.Write(sid, map[string]interface{}{"user": user})
+	pongtest.New(t, po).Get("/hi").
+		Cookie(&http.Cookie{Name: pong.SessionCookiesName, Value: sid}).
+		Do().AssertStatus(http.StatusOK)
 }
 
 func TestUpdateSessionValue(t *testing.T) {
-	po, baseURL := runPong()
+	po := pong.New()
 	po.EnableSession(sessionManager)
 	root := po.Root
 	root.Get("/initSession", func(c *pong.Context) {
 		c.Session.Set(map[string]interface{}{
 			"name": "吴浩麟",
-			"age": 23,
+			"age":  23,
 		})
 		c.Response.String("initSession")
 	})
 	root.Get("/updateSessionValue", func(c *pong.Context) {
 		c.Session.Set(map[string]interface{}{
 			"name": "halwu",
-			"age": 100,
+			"age":  100,
 		})
 		c.Response.String("updateSessionValue")
 	})
-	defer func() {
-		client := http.Client{}
-		res, err := client.Get(baseURL + "/initSession")
-		if err != nil {
-			t.Error(err)
-		} else {
-			cookies := res.Cookies()
-			if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
-				t.Error(cookies)
-			}
-			sid := cookies[0].Value
-			sValue := sessionManager.Read(sid)
-			if sValue["name"] != "吴浩麟" || sValue["age"] != 23 {
-				t.Error(sValue)
-			}
-			jar, _ := cookiejar.New(nil)
-			url, _ := url.Parse(baseURL + "/updateSessionValue")
-			jar.SetCookies(url, cookies)
-			client.Jar = jar
-			_, err = client.Get(url.String())
-			if err != nil {
-				t.Error(err)
-			} else {
-				sValue := sessionManager.Read(sid)
-				if sValue["name"] != "halwu" || sValue["age"] != 100 {
-					t.Error(sValue)
-				}
-			}
-			t.Log(`TestUpdateSessionValue`)
-		}
-	}()
+	client := pongtest.New(t, po)
+	cookies := client.Get("/initSession").Do().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
+		t.Fatal(cookies)
+	}
+	sid := cookies[0].Value
+	sValue := sessionManager.Read(sid)
+	if sValue["name"] != "吴浩麟" || sValue["age"] != 23 {
+		t.Error(sValue)
+	}
+	client.Get("/updateSessionValue").Do()
+	sValue = sessionManager.Read(sid)
+	if sValue["name"] != "halwu" || sValue["age"] != 100 {
+		t.Error(sValue)
+	}
 }
 
 func TestResetSessionValue(t *testing.T) {
-	po, baseURL := runPong()
+	po := pong.New()
 	po.EnableSession(sessionManager)
 	root := po.Root
 	root.Get("/initSession", func(c *pong.Context) {
 		c.Session.Set(map[string]interface{}{
 			"name": "吴浩麟",
-			"age": 23,
+			"age":  23,
 		})
 		c.Response.String("initSession")
 	})
@@ -156,50 +126,33 @@ func TestResetSessionValue(t *testing.T) {
 		c.ResetSession()
 		c.Response.String("resetSessionValue")
 	})
-	defer func() {
-		client := http.Client{}
-		res, err := client.Get(baseURL + "/initSession")
-		if err != nil {
-			t.Error(err)
-		} else {
-			cookies := res.Cookies()
-			if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
-				t.Error(cookies)
-			}
-			sid := cookies[0].Value
-			jar, _ := cookiejar.New(nil)
-			url, _ := url.Parse(baseURL + "/resetSessionValue")
-			jar.SetCookies(url, cookies)
-			client.Jar = jar
-			res, err = client.Get(url.String())
-			if err != nil {
-				t.Error(err)
-			} else {
-				sid2 := res.Cookies()[0].Value
-				if sid2 == sid {
-					t.Error("sid should be diff")
-				}
-				if sessionManager.Read(sid) != nil {
-					t.Error("old sid value in session store should nil")
-				}
-				sValue := sessionManager.Read(sid2)
-				if sValue["name"] != "吴浩麟" || sValue["age"] != 23 {
-					t.Error(sValue)
-				}
-			}
-			t.Log(`TestResetSessionValue`)
-		}
-	}()
+	client := pongtest.New(t, po)
+	cookies := client.Get("/initSession").Do().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
+		t.Fatal(cookies)
+	}
+	sid := cookies[0].Value
+	sid2 := client.Get("/resetSessionValue").Do().Cookie(pong.SessionCookiesName).Value
+	if sid2 == sid {
+		t.Error("sid should be diff")
+	}
+	if sessionManager.Read(sid) != nil {
+		t.Error("old sid value in session store should nil")
+	}
+	sValue := sessionManager.Read(sid2)
+	if sValue["name"] != "吴浩麟" || sValue["age"] != 23 {
+		t.Error(sValue)
+	}
 }
 
 func TestDestorySession(t *testing.T) {
-	po, baseURL := runPong()
+	po := pong.New()
 	po.EnableSession(sessionManager)
 	root := po.Root
 	root.Get("/initSession", func(c *pong.Context) {
 		c.Session.Set(map[string]interface{}{
 			"name": "吴浩麟",
-			"age": 23,
+			"age":  23,
 		})
 		c.Response.String("initSession")
 	})
@@ -207,66 +160,617 @@ func TestDestorySession(t *testing.T) {
 		c.DestorySession()
 		c.Response.String("destorySessionValue")
 	})
-	defer func() {
-		client := http.Client{}
-		res, err := client.Get(baseURL + "/initSession")
-		if err != nil {
+	client := pongtest.New(t, po)
+	cookies := client.Get("/initSession").Do().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
+		t.Fatal(cookies)
+	}
+	sid := cookies[0].Value
+	res := client.Get("/destorySessionValue").Do()
+	if sessionManager.Read(sid) != nil {
+		t.Error("old sid value in session store should nil")
+	}
+	removeCookieHeader := res.Header.Get("Set-Cookie")
+	if removeCookieHeader != pong.SessionCookiesName+"=; Path=/; Max-Age=0; HttpOnly; SameSite=Lax" {
+		t.Error(removeCookieHeader)
+	}
+}
+
+func TestSessionAfterLogout(t *testing.T) {
+	po := pong.New()
+	po.EnableSession(New())
+	root := po.Root
+	root.Get("/login", func(c *pong.Context) {
+		c.Session.Put("name", "吴浩麟")
+		c.Response.String(c.Session.ID())
+	})
+	root.Get("/logout", func(c *pong.Context) {
+		if err := c.Logout(); err != nil {
 			t.Error(err)
-		} else {
-			cookies := res.Cookies()
-			if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
-				t.Error(cookies)
-			}
-			sid := cookies[0].Value
-			jar, _ := cookiejar.New(nil)
-			url, _ := url.Parse(baseURL + "/destorySessionValue")
-			jar.SetCookies(url, cookies)
-			client.Jar = jar
-			res, err = client.Get(url.String())
-			if err != nil {
-				t.Error(err)
-			} else {
-				if sessionManager.Read(sid) != nil {
-					t.Error("old sid value in session store should nil")
-				}
-				removeCookieHeader := res.Header.Get("Set-Cookie")
-				if removeCookieHeader != pong.SessionCookiesName + "=; Max-Age=0" {
-					t.Error(removeCookieHeader)
-				}
-			}
-			t.Log(`TestDestorySession`)
 		}
-	}()
+		// session is empty but still usable
+		if c.Session.Get("name") != nil || !c.Session.IsNew() {
+			t.Error("session should be empty after logout")
+		}
+		c.Session.Put("flash", "bye")
+		c.Response.String(c.Session.GetString("flash", ""))
+	})
+	root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", "") + c.Session.GetString("flash", ""))
+	})
+	client := pongtest.New(t, po)
+	sid := client.Get("/login").Do().String()
+	client.Get("/logout").Do().AssertStatus(http.StatusOK).AssertBody("bye")
+	if cookie := client.Cookie(pong.SessionCookiesName); cookie == nil || cookie.Value == sid {
+		t.Error("a new session should be make after logout", cookie)
+	}
+	client.Get("/get").Do().AssertBody("bye")
 }
 
 func TestCheaterSession(t *testing.T) {
-	po, baseURL := runPong()
+	po := pong.New()
+	po.EnableSession(sessionManager)
+	po.Root.Get("/hi", func(c *pong.Context) {
+		c.Session.Set(map[string]interface{}{"name": "吴浩麟"})
+		c.Response.String("initSession")
+	})
+	cheaterSid := "cheaterSid-cheaterSid"
+	res := pongtest.New(t, po).Get("/hi").
+		Cookie(&http.Cookie{Name: pong.SessionCookiesName, Value: cheaterSid}).
+		Do()
+	cookies := res.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName || cookies[0].Value == cheaterSid {
+		t.Error(cookies)
+	}
+}
+
+func TestSessionTypedGet(t *testing.T) {
+	po := pong.New()
 	po.EnableSession(sessionManager)
 	root := po.Root
-	root.Get("/hi", func(c *pong.Context) {
+	root.Get("/initSession", func(c *pong.Context) {
+		c.Session.Set(map[string]interface{}{
+			"name":  "吴浩麟",
+			"age":   23,
+			"money": float64(100),
+			"alive": true,
+			"big":   uint64(math.MaxUint64),
+			"huge":  float64(1e300),
+			"price": float32(9.5),
+		})
 		c.Response.String("initSession")
 	})
-	defer func() {
-		client := http.Client{}
-		res, err := client.Get(baseURL + "/hi")
-		if err != nil {
+	root.Get("/typed", func(c *pong.Context) {
+		if c.Session.GetString("name", "") != "吴浩麟" || c.Session.GetString("age", "default") != "default" {
+			t.Error(c.Session.GetString("name", ""))
+		}
+		if c.Session.GetInt("age", 0) != 23 || c.Session.GetInt("money", 0) != 100 || c.Session.GetInt("no-this", -1) != -1 {
+			t.Error(c.Session.GetInt("age", 0))
+		}
+		if c.Session.GetFloat64("age", 0) != 23 || !c.Session.GetBool("alive", false) {
+			t.Error(c.Session.GetFloat64("age", 0))
+		}
+		// overflow int return default, float is read without truncate
+		if c.Session.GetInt("big", -1) != -1 || c.Session.GetInt("huge", -1) != -1 || c.Session.GetInt("price", -1) != -1 {
+			t.Error(c.Session.GetInt("big", -1), c.Session.GetInt("huge", -1))
+		}
+		if c.Session.GetFloat64("big", 0) != math.MaxUint64 || c.Session.GetFloat64("price", 0) != 9.5 {
+			t.Error(c.Session.GetFloat64("big", 0), c.Session.GetFloat64("price", 0))
+		}
+		if name, ok := pong.SessionGetAs[string](c.Session, "name"); !ok || name != "吴浩麟" {
+			t.Error(name)
+		}
+		c.Response.String("typed")
+	})
+	client := pongtest.New(t, po)
+	client.Get("/initSession").Do().AssertStatus(http.StatusOK)
+	client.Get("/typed").Do().AssertStatus(http.StatusOK)
+}
+
+func TestSessionOptions(t *testing.T) {
+	po := pong.New()
+	po.EnableSession(New(), pong.SessionOptions{
+		CookieName: "sid",
+		Domain:     "example.com",
+		Path:       "/app",
+		Secure:     true,
+		SameSite:   http.SameSiteStrictMode,
+		Persistent: true,
+		MaxAge:     3600,
+	})
+	root := po.Root
+	root.Get("/app/init", func(c *pong.Context) {
+		c.Session.Set(map[string]interface{}{"name": "吴浩麟"})
+		c.Response.String("")
+	})
+	root.Get("/app/reset", func(c *pong.Context) {
+		c.ResetSession()
+		c.Response.String("")
+	})
+	root.Get("/app/destory", func(c *pong.Context) {
+		c.DestorySession()
+		c.Response.String("")
+	})
+	client := pongtest.New(t, po)
+	client.BaseURL = "https://example.com"
+	assertCookie := func(cookie *http.Cookie, maxAge int) {
+		t.Helper()
+		if cookie == nil {
+			t.Fatal("session cookie should be set")
+		}
+		if cookie.Domain != "example.com" || cookie.Path != "/app" || !cookie.Secure || !cookie.HttpOnly ||
+			cookie.SameSite != http.SameSiteStrictMode || cookie.MaxAge != maxAge {
+			t.Error(cookie)
+		}
+	}
+	assertCookie(client.Get("/app/init").Do().Cookie("sid"), 3600)
+	assertCookie(client.Get("/app/reset").Do().Cookie("sid"), 3600)
+	assertCookie(client.Get("/app/destory").Do().Cookie("sid"), -1)
+}
+
+// count calls to session manager
+type countSessionIO struct {
+	pong.SessionIO
+	has, read, write, newSession int
+}
+
+func (s *countSessionIO) Has(sessionId string) bool {
+	s.has++
+	return s.SessionIO.Has(sessionId)
+}
+
+func (s *countSessionIO) Read(sessionId string) map[string]interface{} {
+	s.read++
+	return s.SessionIO.Read(sessionId)
+}
+
+func (s *countSessionIO) Write(sessionId string, changes map[string]interface{}) error {
+	s.write++
+	return s.SessionIO.Write(sessionId, changes)
+}
+
+func (s *countSessionIO) NewSession() string {
+	s.newSession++
+	return s.SessionIO.NewSession()
+}
+
+func TestLazySession(t *testing.T) {
+	counter := &countSessionIO{SessionIO: New()}
+	po := pong.New()
+	po.EnableSession(counter)
+	root := po.Root
+	root.Get("/static", func(c *pong.Context) {
+		c.Response.String("static")
+	})
+	root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	root.Get("/set", func(c *pong.Context) {
+		c.Session.Set(map[string]interface{}{"name": "吴浩麟"})
+		c.Session.Set(map[string]interface{}{"age": 23})
+		c.Session.Set(map[string]interface{}{"name": "halwu"})
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	client := pongtest.New(t, po)
+	client.Get("/static").Do()
+	client.Get("/get").Do()
+	if counter.has+counter.read+counter.write+counter.newSession != 0 || client.Cookie(pong.SessionCookiesName) != nil {
+		t.Error("session not changed should not touch session manager or set cookie", *counter)
+	}
+	client.Get("/set").Do().AssertBody("halwu")
+	if counter.newSession != 1 || counter.write != 1 {
+		t.Error("changes should be write once", *counter)
+	}
+	sid := client.Cookie(pong.SessionCookiesName).Value
+	if value := counter.SessionIO.Read(sid); value["name"] != "halwu" || value["age"] != 23 {
+		t.Error(value)
+	}
+	*counter = countSessionIO{SessionIO: counter.SessionIO}
+	client.Get("/static").Do()
+	if counter.has+counter.read != 0 {
+		t.Error("session not accessed should not be loaded", *counter)
+	}
+	res := client.Get("/get").Do().AssertBody("halwu")
+	if counter.read != 1 || counter.write != 0 || len(res.Cookies()) != 0 {
+		t.Error("session only read should not be write", *counter, res.Cookies())
+	}
+}
+
+// session manager which fail to write
+type failWriteSessionIO struct {
+	pong.SessionIO
+}
+
+func (s failWriteSessionIO) Write(sessionId string, changes map[string]interface{}) error {
+	return errors.New("store is down")
+}
+
+func TestSaveSessionFail(t *testing.T) {
+	po := pong.New()
+	po.EnableSession(failWriteSessionIO{New()})
+	po.Root.Get("/set", func(c *pong.Context) {
+		c.Session.Set(map[string]interface{}{"name": "吴浩麟"})
+		c.Response.String("saved")
+	})
+	// error is give to HTTPErrorHandle instead of the handle's response
+	pongtest.New(t, po).Get("/set").Do().AssertStatus(http.StatusInternalServerError).AssertBody("store is down")
+}
+
+func TestSessionAPI(t *testing.T) {
+	po := pong.New()
+	po.EnableSession(New())
+	root := po.Root
+	root.Get("/new", func(c *pong.Context) {
+		if !c.Session.IsNew() || len(c.Session.ID()) != 0 {
+			t.Error("session should be new", c.Session.ID())
+		}
+		c.Session.Put("name", "吴浩麟")
+		c.Session.Put("age", 23)
+		if err := c.Session.Save(); err != nil {
 			t.Error(err)
-		} else {
-			jar, _ := cookiejar.New(nil)
-			url, _ := url.Parse(baseURL + "/hi")
-			cheaterSid := "cheaterSid-cheaterSid"
-			jar.SetCookies(url, []*http.Cookie{&http.Cookie{Name: pong.SessionCookiesName, Value: cheaterSid}})
-			client.Jar = jar
-			res, err = client.Get(url.String())
-			if err != nil {
-				t.Error(err)
-			} else {
-				cookies := res.Cookies()
-				if len(cookies) != 1 || cookies[0].Name != pong.SessionCookiesName {
-					t.Error(cookies)
-				}
-			}
-			t.Log(`TestCheaterSession`)
 		}
+		if c.Session.IsNew() || len(c.Session.ID()) == 0 {
+			t.Error("session should has id after save")
+		}
+		c.Response.String(c.Session.ID())
+	})
+	root.Get("/keys", func(c *pong.Context) {
+		c.Session.AddFlash("hi")
+		if c.Session.IsNew() {
+			t.Error("session should exist")
+		}
+		c.Response.String(strings.Join(c.Session.Keys(), ","))
+	})
+	root.Get("/putDelete", func(c *pong.Context) {
+		c.Session.Delete("name")
+		c.Session.Put("name", "halwu")
+		c.Session.Put("age", 24)
+		c.Session.Delete("age")
+		c.Response.String(strings.Join(c.Session.Keys(), ","))
+	})
+	client := pongtest.New(t, po)
+	sid := client.Get("/new").Do().String()
+	if cookie := client.Cookie(pong.SessionCookiesName); cookie == nil || cookie.Value != sid {
+		t.Error("cookie should be set by Save", cookie)
+	}
+	client.Get("/keys").Do().AssertBody("age,name")
+	client.Get("/putDelete").Do().AssertBody("name")
+	client.Get("/keys").Do().AssertBody("name")
+}
+
+func TestSessionTransport(t *testing.T) {
+	po := pong.New()
+	po.EnableSession(New())
+	root := po.Root
+	api := root.Router("/api")
+	api.SessionTransport(pong.HeaderTransport{})
+	bearer := root.Router("/bearer")
+	bearer.SessionTransport(pong.BearerTransport{ResponseHeader: "X-Token"})
+	for _, router := range []*pong.Router{root, api, bearer} {
+		router.Get("/set", func(c *pong.Context) {
+			c.Session.Put("name", "吴浩麟")
+			c.Response.String("")
+		})
+		router.Get("/get", func(c *pong.Context) {
+			c.Response.String(c.Session.GetString("name", ""))
+		})
+		router.Get("/reset", func(c *pong.Context) {
+			c.ResetSession()
+			c.Response.String("")
+		})
+		router.Get("/destory", func(c *pong.Context) {
+			c.DestorySession()
+			c.Response.String("")
+		})
+	}
+	client := pongtest.New(t, po)
+
+	// API client carry sessionId in header, no cookie
+	res := client.Get("/api/set").Do()
+	token := res.Header.Get(pong.SessionTokenHeader)
+	if len(token) == 0 || len(res.Cookies()) != 0 {
+		t.Fatal("sessionId should be send by header only", res.Header)
+	}
+	client.Get("/api/get").Do().AssertBody("")
+	client.Get("/api/get").Header(pong.SessionTokenHeader, token).Do().AssertBody("吴浩麟")
+	// not touched session don't echo header
+	if res = client.Get("/api/get").Header(pong.SessionTokenHeader, token).Do(); len(res.Header.Values(pong.SessionTokenHeader)) != 0 {
+		t.Error("header should only be send when session is made or reset")
+	}
+	newToken := client.Get("/api/reset").Header(pong.SessionTokenHeader, token).Do().Header.Get(pong.SessionTokenHeader)
+	if len(newToken) == 0 || newToken == token {
+		t.Fatal("reset should echo new sessionId", newToken)
+	}
+	client.Get("/api/get").Header(pong.SessionTokenHeader, token).Do().AssertBody("")
+	client.Get("/api/get").Header(pong.SessionTokenHeader, newToken).Do().AssertBody("吴浩麟")
+	res = client.Get("/api/destory").Header(pong.SessionTokenHeader, newToken).Do()
+	if values := res.Header.Values(pong.SessionTokenHeader); len(values) != 1 || values[0] != "" {
+		t.Error("destory should send empty header", values)
+	}
+	client.Get("/api/get").Header(pong.SessionTokenHeader, newToken).Do().AssertBody("")
+
+	// bearer token
+	token = client.Get("/bearer/set").Do().Header.Get("X-Token")
+	if len(token) == 0 {
+		t.Fatal("sessionId should be send by X-Token header")
+	}
+	client.Get("/bearer/get").Header("Authorization", "Bearer "+token).Do().AssertBody("吴浩麟")
+	client.Get("/bearer/get").Header("Authorization", "bearer "+token).Do().AssertBody("吴浩麟")
+	client.Get("/bearer/get").Header("Authorization", "Basic "+token).Do().AssertBody("")
+	// header of other router is not read
+	client.Get("/get").Header(pong.SessionTokenHeader, token).Do().AssertBody("")
+
+	// web UI still use cookie
+	if cookie := client.Get("/set").Do().Cookie(pong.SessionCookiesName); cookie == nil {
+		t.Fatal("root router should use cookie")
+	}
+	client.Get("/get").Do().AssertBody("吴浩麟")
+	client.Get("/api/get").Do().AssertBody("")
+}
+
+func TestSessionLockTimeout(t *testing.T) {
+	store := New()
+	po := pong.New()
+	po.EnableSession(store, pong.SessionOptions{Lock: true, LockTimeout: 20 * time.Millisecond})
+	po.Root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟"})
+	cookie := &http.Cookie{Name: pong.SessionCookiesName, Value: sid}
+	client := pongtest.New(t, po)
+	unlock, err := store.Lock(context.Background(), sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Get("/get").Cookie(cookie).Do().AssertStatus(http.StatusServiceUnavailable).AssertBody(pong.ErrorSessionLockTimeout.Error())
+	unlock()
+	client.Get("/get").Cookie(cookie).Do().AssertStatus(http.StatusOK).AssertBody("吴浩麟")
+	// lock is released after response
+	client.Get("/get").Cookie(cookie).Do().AssertStatus(http.StatusOK)
+	if len(store.locks) != 0 {
+		t.Error("unused lock should be removed", store.locks)
+	}
+}
+
+func TestSessionLockReleaseAfterTimeout(t *testing.T) {
+	store := New()
+	po := pong.New()
+	po.EnableSession(store, pong.SessionOptions{Lock: true, LockTimeout: 20 * time.Millisecond})
+	returned := make(chan bool)
+	po.Root.Get("/slow", pong.Timeout(10*time.Millisecond, func(c *pong.Context) {
+		c.Session.Get("name")
+		time.Sleep(50 * time.Millisecond)
+		close(returned)
+	}))
+	po.Root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟"})
+	cookie := &http.Cookie{Name: pong.SessionCookiesName, Value: sid}
+	client := pongtest.New(t, po)
+	client.Get("/slow").Cookie(cookie).Do().AssertStatus(http.StatusServiceUnavailable).AssertBody(pong.ErrorHandleTimeout.Error())
+	// lock is hold until the timeout handle return
+	client.Get("/get").Cookie(cookie).Do().AssertStatus(http.StatusServiceUnavailable)
+	<-returned
+	time.Sleep(10 * time.Millisecond)
+	client.Get("/get").Cookie(cookie).Do().AssertStatus(http.StatusOK).AssertBody("吴浩麟")
+}
+
+func TestSessionLockReleaseAfterPanic(t *testing.T) {
+	store := New()
+	po := pong.New()
+	po.EnableSession(store, pong.SessionOptions{Lock: true, LockTimeout: 20 * time.Millisecond})
+	po.Root.Get("/panic", func(c *pong.Context) {
+		c.Session.Get("name")
+		panic("handle panic")
+	})
+	po.Root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟"})
+	cookie := &http.Cookie{Name: pong.SessionCookiesName, Value: sid}
+	func() {
+		defer func() {
+			if p := recover(); p != "handle panic" {
+				t.Error(p)
+			}
+		}()
+		req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+		req.AddCookie(cookie)
+		po.ServeHTTP(httptest.NewRecorder(), req)
 	}()
+	pongtest.New(t, po).Get("/get").Cookie(cookie).Do().AssertStatus(http.StatusOK).AssertBody("吴浩麟")
+}
+
+func TestSessionLockTTL(t *testing.T) {
+	store := NewWithOptions(Options{LockTTL: 10 * time.Millisecond})
+	unlock, err := store.Lock(context.Background(), "sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// lock not unlocked is released after LockTTL
+	unlock2, err := store.Lock(ctx, "sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unlock an expired lock do nothing
+	unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := NewWithOptions(Options{}).Lock(ctx, "sid"); err != nil {
+		t.Error(err)
+	}
+	if _, err := store.Lock(ctx, "sid"); err != context.DeadlineExceeded {
+		t.Error("lock should still be hold", err)
+	}
+	unlock2()
+}
+
+func TestSessionSecurity(t *testing.T) {
+	store := New()
+	po := pong.New()
+	po.EnableSession(store, pong.SessionOptions{
+		AbsoluteTimeout: time.Hour,
+		Binding: pong.SessionBinding{
+			UserAgent:  true,
+			IPv4Prefix: 24,
+			Strict:     true,
+			ClientIP: func(c *pong.Context) string {
+				return c.Request.HTTPRequest.Header.Get("X-Real-IP")
+			},
+		},
+	})
+	po.Root.Get("/login", func(c *pong.Context) {
+		if err := c.Login(c.Request.Query("user")); err != nil {
+			t.Fatal(err)
+		}
+		c.Response.String(c.Session.ID())
+	})
+	po.Root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.UserID() + strings.Join(c.Session.Keys(), ","))
+	})
+	po.Root.Get("/logout", func(c *pong.Context) {
+		c.Logout()
+		c.Response.String("")
+	})
+	session := func(sid string) *http.Cookie {
+		return &http.Cookie{Name: pong.SessionCookiesName, Value: sid}
+	}
+	// every request is send by a new client without cookie jar, to act as different clients
+	request := func(path string, sid string, userAgent string, ip string) *pongtest.Response {
+		return pongtest.New(t, po).Get(path).Query("user", "halwu").Cookie(session(sid)).Header("User-Agent", userAgent).Header("X-Real-IP", ip).Do()
+	}
+
+	// session fixation: sessionId known by attacker is useless after login
+	fixed := store.NewSession()
+	store.Write(fixed, map[string]interface{}{"cart": 1})
+	sid := request("/login", fixed, "ua", "10.0.0.1").String()
+	if len(sid) == 0 || sid == fixed {
+		t.Fatal("login should regenerate sessionId", sid)
+	}
+	if store.Has(fixed) {
+		t.Error("old sessionId should be removed after login")
+	}
+	// values are keep and pong's own values are hidden
+	request("/get", sid, "ua", "10.0.0.1").AssertBody("halwucart")
+	// same IP prefix is allowed
+	request("/get", sid, "ua", "10.0.0.200").AssertBody("halwucart")
+
+	// binding: another client can't use stolen sessionId, and strict binding destroy it
+	request("/get", sid, "other ua", "10.0.0.1").AssertBody("")
+	if store.Has(sid) {
+		t.Error("strict binding should destroy session accessed by other client")
+	}
+	sid = request("/login", "", "ua", "10.0.0.1").String()
+	request("/get", sid, "ua", "10.0.1.1").AssertBody("")
+	if store.Has(sid) {
+		t.Error("strict binding should destroy session accessed by other IP prefix")
+	}
+
+	// absolute lifetime is enforced regardless of activity
+	sid = request("/login", "", "ua", "10.0.0.1").String()
+	request("/get", sid, "ua", "10.0.0.1").AssertBody("halwu")
+	store.Write(sid, map[string]interface{}{"_pong_created": time.Now().Add(-2 * time.Hour).Unix()})
+	request("/get", sid, "ua", "10.0.0.1").AssertBody("")
+	if store.Has(sid) {
+		t.Error("session exceed AbsoluteTimeout should be destroyed")
+	}
+
+	// logout
+	sid = request("/login", "", "ua", "10.0.0.1").String()
+	request("/logout", sid, "ua", "10.0.0.1")
+	if store.Has(sid) {
+		t.Error("logout should destroy session")
+	}
+}
+
+func TestSessionBindingNotStrict(t *testing.T) {
+	store := New()
+	po := pong.New()
+	po.EnableSession(store, pong.SessionOptions{Binding: pong.SessionBinding{UserAgent: true}})
+	po.Root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟"})
+	cookie := &http.Cookie{Name: pong.SessionCookiesName, Value: sid}
+	client := pongtest.New(t, po)
+	// session made before Binding is bind to the first client
+	client.Get("/get").Cookie(cookie).Header("User-Agent", "ua").Do().AssertBody("吴浩麟")
+	client.Get("/get").Cookie(cookie).Header("User-Agent", "other ua").Do().AssertBody("")
+	if !store.Has(sid) {
+		t.Fatal("not strict binding should keep session")
+	}
+	client.Get("/get").Cookie(cookie).Header("User-Agent", "ua").Do().AssertBody("吴浩麟")
+}
+
+// a SessionAdmin without SessionUserIndex, sessions of user are find by List
+type adminWithoutIndex struct {
+	pong.SessionAdmin
+}
+
+func TestMountSessionAdminWithoutIndex(t *testing.T) {
+	store := New()
+	po := pong.New()
+	po.EnableSession(store)
+	po.Root.Get("/login", func(c *pong.Context) {
+		c.TagSession(c.Request.Query("user"))
+		c.Response.String(c.Session.ID())
+	})
+	pong.MountSessionAdmin(po.Root.Router("/admin"), adminWithoutIndex{store})
+	sids := make([]string, 0, 3)
+	for _, user := range []string{"alice", "alice", "bob"} {
+		sids = append(sids, pongtest.New(t, po).Get("/login").Query("user", user).Do().String())
+	}
+	client := pongtest.New(t, po)
+	var listed []pong.SessionInfo
+	client.Get("/admin/sessions").Query("user", "alice").Do().AssertStatus(http.StatusOK).BindJSON(&listed)
+	if len(listed) != 2 || listed[0].ID == sids[0] || listed[0].ID == sids[1] {
+		t.Error(listed)
+	}
+	client.Delete("/admin/sessions").Query("user", "alice").Do().AssertJSON(map[string]int{"revoked": 2})
+	if store.Has(sids[0]) || store.Has(sids[1]) || !store.Has(sids[2]) {
+		t.Error("only sessions of alice should be revoked")
+	}
+}
+
+// a Store count how many times Touch is called
+type countTouchStore struct {
+	*Store
+	touches int32
+}
+
+func (store *countTouchStore) Touch(ctx context.Context, sessionId string, ip string, userAgent string) error {
+	atomic.AddInt32(&store.touches, 1)
+	return store.Store.Touch(ctx, sessionId, ip, userAgent)
+}
+
+func TestSessionTouchInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -1} {
+		store := &countTouchStore{Store: New()}
+		po := pong.New()
+		po.EnableSession(store, pong.SessionOptions{TouchInterval: interval})
+		po.Root.Get("/set", func(c *pong.Context) {
+			c.Session.Put("name", "吴浩麟")
+			c.Response.String("")
+		})
+		po.Root.Get("/get", func(c *pong.Context) {
+			c.Response.String(c.Session.GetString("name", ""))
+		})
+		client := pongtest.New(t, po)
+		client.Get("/set").Do()
+		for i := 0; i < 3; i++ {
+			client.Get("/get").Do().AssertBody("吴浩麟")
+		}
+		touches := atomic.LoadInt32(&store.touches)
+		// default TouchInterval touch a session only once in a minute, negative touch it on every access
+		if interval == 0 && touches != 1 || interval < 0 && touches != 4 {
+			t.Error(interval, touches)
+		}
+	}
 }
@@ -0,0 +1,499 @@
+package redis_session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/redis.v3"
+)
+
+// fakeRedis is an in process stand-in of redis server which speak RESP,
+// it support the commands redis_session use, client connect to it by net.Pipe so no port is listened
+type fakeRedis struct {
+	lock   sync.Mutex
+	items  map[string]*fakeItem
+	now    func() time.Time
+	closed bool
+	conns  []net.Conn
+	seq    int
+}
+
+type fakeItem struct {
+	str      string
+	hash     map[string]string
+	set      map[string]bool
+	expireAt time.Time
+	version  int
+}
+
+func (item *fakeItem) hashField(field string) (string, bool) {
+	if item == nil || item.hash == nil {
+		return "", false
+	}
+	value, has := item.hash[field]
+	return value, has
+}
+
+type fakeStatus string
+
+type fakeConn struct {
+	server  *fakeRedis
+	multi   bool
+	queue   [][]string
+	watched map[string]int
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		items: make(map[string]*fakeItem),
+		now:   time.Now,
+	}
+}
+
+// make a redis client connect to this fake server
+func (server *fakeRedis) client() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Dialer: server.dial,
+	})
+}
+
+func (server *fakeRedis) dial() (net.Conn, error) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.closed {
+		return nil, fmt.Errorf("fake redis closed")
+	}
+	client, conn := net.Pipe()
+	server.conns = append(server.conns, conn)
+	go server.serve(conn)
+	return client, nil
+}
+
+// close all connections and refuse new one, used to simulate redis outage
+func (server *fakeRedis) close() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.closed = true
+	for _, conn := range server.conns {
+		conn.Close()
+	}
+}
+
+func (server *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	c := &fakeConn{server: server}
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		bs := writeReply(nil, c.handle(args))
+		if _, err := conn.Write(bs); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, _ := strconv.Atoi(line[1:])
+	args := make([]string, n)
+	for i := range args {
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimRight(line, "\r\n")[1:])
+		bs := make([]byte, size+2)
+		if _, err = io.ReadFull(reader, bs); err != nil {
+			return nil, err
+		}
+		args[i] = string(bs[:size])
+	}
+	return args, nil
+}
+
+func writeReply(bs []byte, reply interface{}) []byte {
+	switch r := reply.(type) {
+	case nil:
+		return append(bs, "$-1\r\n"...)
+	case fakeStatus:
+		return append(bs, "+"+string(r)+"\r\n"...)
+	case error:
+		return append(bs, "-"+r.Error()+"\r\n"...)
+	case int:
+		return append(bs, ":"+strconv.Itoa(r)+"\r\n"...)
+	case string:
+		return append(bs, "$"+strconv.Itoa(len(r))+"\r\n"+r+"\r\n"...)
+	case []string:
+		bs = append(bs, "*"+strconv.Itoa(len(r))+"\r\n"...)
+		for _, s := range r {
+			bs = writeReply(bs, s)
+		}
+		return bs
+	case []interface{}:
+		if r == nil {
+			return append(bs, "*-1\r\n"...)
+		}
+		bs = append(bs, "*"+strconv.Itoa(len(r))+"\r\n"...)
+		for _, s := range r {
+			bs = writeReply(bs, s)
+		}
+		return bs
+	}
+	panic(fmt.Sprintf("fake redis:unknown reply %T", reply))
+}
+
+func (c *fakeConn) handle(args []string) interface{} {
+	if len(args) == 0 {
+		return fmt.Errorf("ERR empty command")
+	}
+	server := c.server
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	name := strings.ToUpper(args[0])
+	switch name {
+	case "MULTI":
+		c.multi = true
+		c.queue = nil
+		return fakeStatus("OK")
+	case "DISCARD":
+		c.multi = false
+		c.queue = nil
+		c.watched = nil
+		return fakeStatus("OK")
+	case "WATCH":
+		if c.watched == nil {
+			c.watched = make(map[string]int)
+		}
+		for _, key := range args[1:] {
+			c.watched[key] = server.version(key)
+		}
+		return fakeStatus("OK")
+	case "UNWATCH":
+		c.watched = nil
+		return fakeStatus("OK")
+	case "EXEC":
+		queue, watched := c.queue, c.watched
+		c.multi, c.queue, c.watched = false, nil, nil
+		for key, version := range watched {
+			if server.version(key) != version {
+				return []interface{}(nil)
+			}
+		}
+		replies := make([]interface{}, 0, len(queue))
+		for _, queued := range queue {
+			replies = append(replies, server.exec(queued))
+		}
+		return replies
+	}
+	if c.multi {
+		c.queue = append(c.queue, args)
+		return fakeStatus("QUEUED")
+	}
+	return server.exec(args)
+}
+
+// version of a key, changed by every write, used by WATCH
+func (server *fakeRedis) version(key string) int {
+	if item := server.get(key); item != nil {
+		return item.version
+	}
+	return -1
+}
+
+// get an item which is not expired
+func (server *fakeRedis) get(key string) *fakeItem {
+	item := server.items[key]
+	if item != nil && !item.expireAt.IsZero() && !server.now().Before(item.expireAt) {
+		delete(server.items, key)
+		return nil
+	}
+	return item
+}
+
+func (server *fakeRedis) touch(key string) *fakeItem {
+	item := server.get(key)
+	if item == nil {
+		item = &fakeItem{}
+		server.items[key] = item
+	}
+	server.seq++
+	item.version = server.seq
+	return item
+}
+
+// remove item if it's hash or set become empty, like redis
+func (server *fakeRedis) clean(key string) {
+	if item := server.items[key]; item != nil && item.hash != nil && len(item.hash) == 0 {
+		delete(server.items, key)
+	}
+	if item := server.items[key]; item != nil && item.set != nil && len(item.set) == 0 {
+		delete(server.items, key)
+	}
+}
+
+func (server *fakeRedis) exec(args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+	wrongArgs := fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+	switch name {
+	case "PING":
+		return fakeStatus("PONG")
+	case "SELECT", "AUTH":
+		return fakeStatus("OK")
+	case "EXISTS":
+		count := 0
+		for _, key := range args {
+			if server.get(key) != nil {
+				count++
+			}
+		}
+		return count
+	case "DEL":
+		count := 0
+		for _, key := range args {
+			if server.get(key) != nil {
+				server.touch(key)
+				delete(server.items, key)
+				count++
+			}
+		}
+		return count
+	case "GET":
+		item := server.get(args[0])
+		if item == nil || item.hash != nil || item.set != nil {
+			return nil
+		}
+		return item.str
+	case "SET":
+		key, value := args[0], args[1]
+		var expire time.Duration
+		nx := false
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX":
+				ms, _ := strconv.Atoi(args[i+1])
+				expire = time.Duration(ms) * time.Millisecond
+				i++
+			case "EX":
+				s, _ := strconv.Atoi(args[i+1])
+				expire = time.Duration(s) * time.Second
+				i++
+			}
+		}
+		if nx && server.get(key) != nil {
+			return nil
+		}
+		item := server.touch(key)
+		item.str, item.hash, item.set, item.expireAt = value, nil, nil, time.Time{}
+		if expire > 0 {
+			item.expireAt = server.now().Add(expire)
+		}
+		return fakeStatus("OK")
+	case "PEXPIRE", "EXPIRE":
+		if len(args) != 2 {
+			return wrongArgs
+		}
+		item := server.get(args[0])
+		if item == nil {
+			return 0
+		}
+		n, _ := strconv.Atoi(args[1])
+		unit := time.Millisecond
+		if name == "EXPIRE" {
+			unit = time.Second
+		}
+		item.expireAt = server.now().Add(time.Duration(n) * unit)
+		return 1
+	case "PTTL":
+		item := server.get(args[0])
+		if item == nil {
+			return -2
+		}
+		if item.expireAt.IsZero() {
+			return -1
+		}
+		return int(item.expireAt.Sub(server.now()) / time.Millisecond)
+	case "RENAME", "RENAMENX":
+		item := server.get(args[0])
+		if item == nil {
+			return fmt.Errorf("ERR no such key")
+		}
+		if name == "RENAMENX" && server.get(args[1]) != nil {
+			return 0
+		}
+		server.touch(args[0])
+		delete(server.items, args[0])
+		server.items[args[1]] = item
+		server.touch(args[1])
+		if name == "RENAME" {
+			return fakeStatus("OK")
+		}
+		return 1
+	case "HSET", "HSETNX", "HMSET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return wrongArgs
+		}
+		key := args[0]
+		if name == "HSETNX" {
+			if item := server.get(key); item != nil && item.hash != nil {
+				if _, has := item.hash[args[1]]; has {
+					return 0
+				}
+			}
+		}
+		item := server.touch(key)
+		if item.hash == nil {
+			item.hash = make(map[string]string)
+		}
+		added := 0
+		for i := 1; i < len(args); i += 2 {
+			if _, has := item.hash[args[i]]; !has {
+				added++
+			}
+			item.hash[args[i]] = args[i+1]
+		}
+		if name == "HMSET" {
+			return fakeStatus("OK")
+		}
+		return added
+	case "HDEL":
+		item := server.get(args[0])
+		if item == nil || item.hash == nil {
+			return 0
+		}
+		server.touch(args[0])
+		count := 0
+		for _, field := range args[1:] {
+			if _, has := item.hash[field]; has {
+				delete(item.hash, field)
+				count++
+			}
+		}
+		server.clean(args[0])
+		return count
+	case "HGET":
+		item := server.get(args[0])
+		if item == nil || item.hash == nil {
+			return nil
+		}
+		value, has := item.hash[args[1]]
+		if !has {
+			return nil
+		}
+		return value
+	case "HMGET":
+		item := server.get(args[0])
+		reply := make([]interface{}, 0, len(args)-1)
+		for _, field := range args[1:] {
+			if value, has := item.hashField(field); has {
+				reply = append(reply, value)
+			} else {
+				reply = append(reply, nil)
+			}
+		}
+		return reply
+	case "HGETALL":
+		item := server.get(args[0])
+		reply := []string{}
+		if item != nil {
+			fields := make([]string, 0, len(item.hash))
+			for field := range item.hash {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				reply = append(reply, field, item.hash[field])
+			}
+		}
+		return reply
+	case "SADD":
+		item := server.touch(args[0])
+		if item.set == nil {
+			item.set = make(map[string]bool)
+		}
+		count := 0
+		for _, member := range args[1:] {
+			if !item.set[member] {
+				item.set[member] = true
+				count++
+			}
+		}
+		return count
+	case "SREM":
+		item := server.get(args[0])
+		if item == nil || item.set == nil {
+			return 0
+		}
+		server.touch(args[0])
+		count := 0
+		for _, member := range args[1:] {
+			if item.set[member] {
+				delete(item.set, member)
+				count++
+			}
+		}
+		server.clean(args[0])
+		return count
+	case "SMEMBERS":
+		item := server.get(args[0])
+		reply := []string{}
+		if item != nil {
+			for member := range item.set {
+				reply = append(reply, member)
+			}
+			sort.Strings(reply)
+		}
+		return reply
+	case "SCARD":
+		item := server.get(args[0])
+		if item == nil {
+			return 0
+		}
+		return len(item.set)
+	case "KEYS", "SCAN":
+		pattern := "*"
+		if name == "KEYS" {
+			pattern = args[0]
+		}
+		for i := 1; name == "SCAN" && i < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		keys := []string{}
+		for key := range server.items {
+			if server.get(key) == nil {
+				continue
+			}
+			if ok, _ := path.Match(pattern, key); ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		if name == "KEYS" {
+			return keys
+		}
+		return []interface{}{"0", keys}
+	}
+	return fmt.Errorf("ERR unknown command '%s'", strings.ToLower(name))
+}
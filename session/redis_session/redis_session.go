@@ -1,60 +1,667 @@
 package redis_session
 
 import (
-	"io"
-	"encoding/base64"
-	"crypto/rand"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/session/codec"
 	"gopkg.in/redis.v3"
 )
 
-//redis sessionManager
-type redisSessionManager struct {
-	pong.SessionIO
-	redisClient *redis.Client
+const (
+	// hash fields start with metaFieldPrefix are used by redis_session itself, not session value
+	metaFieldPrefix = "\x00"
+	// hash field store when the session is created, a session always has it so empty session still exist in redis
+	createdField = metaFieldPrefix + "created"
+	// hash fields store session's metadata used by SessionAdmin
+	userField      = metaFieldPrefix + "user"
+	ipField        = metaFieldPrefix + "ip"
+	userAgentField = metaFieldPrefix + "ua"
+	seenField      = metaFieldPrefix + "seen"
+	// set of sessionIds tag with a user is store in key Prefix + userIndexInfix + userId
+	userIndexInfix = metaFieldPrefix + "user:"
+	// how many keys SCAN return in one call
+	scanCount = 100
+	// max times to retry when a new sessionId has exist
+	maxNewSessionRetry = 10
+	// max times to retry a transaction when the session is changed by others before EXEC
+	maxTxRetry = 10
+	// lock key of a session is it's key + lockKeySuffix
+	lockKeySuffix = ":lock"
+	// how often to retry when session's lock is hold by others
+	lockRetryInterval = 10 * time.Millisecond
+)
+
+var (
+	// this error will be return when operate a session which is not exist or has expired
+	ErrSessionNotFound = errors.New("redis_session:session not found")
+	// this error will be return when can't generate a sessionId which not exist after retry
+	ErrSessionIdConflict = errors.New("redis_session:can't generate unique sessionId")
+)
+
+var (
+	_ pong.SessionIO        = (*Store)(nil)
+	_ pong.IDGeneratorOwner = (*Store)(nil)
+	_ pong.SessionLocker    = (*Store)(nil)
+	_ pong.SessionAdmin     = (*Store)(nil)
+	_ pong.SessionUserIndex = (*Store)(nil)
+)
+
+// hash fields read by SessionAdmin, session value is never read to list sessions
+var metaFields = []string{createdField, userField, ipField, userAgentField, seenField}
+
+// Codec encode a session value to bytes to store in redis hash field, and decode it back
+// it's the same as pong.SessionCodec, see package session/codec for more codecs
+type Codec = pong.SessionCodec
+
+// GobCodec use encoding/gob to encode session value, it's codec.Gob
+// value which type is struct should be registered by codec.Register or gob.Register first
+type GobCodec = codec.Gob
+
+// Options config a redis session store
+// zero value of every field means use default
+type Options struct {
+	// every session is store in a redis hash which key is Prefix + sessionId, default is "pong:session:"
+	Prefix string
+	// session expire after TTL since last read or write, default is 30 minutes
+	TTL time.Duration
+	// codec used to encode every session value, default is codec.Gob
+	Codec Codec
+	// used to generate sessionId, default is pong.RandomIDGenerator
+	IDGenerator pong.IDGenerator
+	// session's lock expire after LockTTL, so a crashed process can't hold it forever, default is 30 seconds
+	// it should be longer than your longest request
+	LockTTL time.Duration
 }
 
-func New(options *redis.Options) pong.SessionIO {
-	return &redisSessionManager{
-		redisClient:redis.NewClient(options),
-	}
+// Store is a redis session store
+// every session is a redis hash, every value in session is a field encode by Codec
+type Store struct {
+	client  *redis.Client
+	options Options
 }
 
-func (manager *redisSessionManager) NewSession() (sessionId string) {
-	bs := make([]byte, 8)
-	io.ReadFull(rand.Reader, bs)
-	sessionId = base64.URLEncoding.EncodeToString(bs)
-	if manager.Has(sessionId) {
-		return manager.NewSession()
+// make a redis session store connect to redis with options and default Options
+func New(options *redis.Options) *Store {
+	return NewWithClient(redis.NewClient(options), Options{})
+}
+
+// make a redis session store use client with options
+func NewWithClient(client *redis.Client, options Options) *Store {
+	if len(options.Prefix) == 0 {
+		options.Prefix = "pong:session:"
+	}
+	if options.TTL <= 0 {
+		options.TTL = 30 * time.Minute
+	}
+	if options.Codec == nil {
+		options.Codec = codec.Gob{}
+	}
+	if options.IDGenerator == nil {
+		options.IDGenerator = pong.RandomIDGenerator{}
+	}
+	if options.LockTTL <= 0 {
+		options.LockTTL = 30 * time.Second
+	}
+	return &Store{
+		client:  client,
+		options: options,
 	}
-	return sessionId
 }
 
-func (manager *redisSessionManager) Destory(sessionId string) error {
-	return manager.redisClient.Del(sessionId).Err()
+// return the IDGenerator used to generate sessionId, pong use it to validate sessionId in cookie
+func (store *Store) IDGenerator() pong.IDGenerator {
+	return store.options.IDGenerator
 }
 
-func (manager *redisSessionManager) Reset(oldSessionId string) (newSessionId string, err error) {
-	newSessionId = manager.NewSession()
-	err = manager.redisClient.Rename(oldSessionId, newSessionId).Err()
+func (store *Store) key(sessionId string) string {
+	return store.options.Prefix + sessionId
+}
+
+func (store *Store) userIndexKey(userId string) string {
+	return store.options.Prefix + userIndexInfix + userId
+}
+
+// make a new session in redis
+// return empty sessionId if redis fail
+func (store *Store) NewSession() (sessionId string) {
+	sessionId, _ = store.newSession()
 	return
 }
 
-func (manager *redisSessionManager) Has(sessionId string) bool {
-	has, _ := manager.redisClient.Exists(sessionId).Result()
-	return has
+// create session hash and set it's TTL in one transaction, the key is WATCHed so an exist session is never overwrite
+func (store *Store) newSession() (string, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for i := 0; i < maxNewSessionRetry; i++ {
+		sessionId, err := store.options.IDGenerator.NewID()
+		if err != nil {
+			return "", err
+		}
+		key := store.key(sessionId)
+		multi, err := store.client.Watch(key)
+		if err != nil {
+			return "", err
+		}
+		has, err := multi.Exists(key).Result()
+		if err == nil && !has {
+			_, err = multi.Exec(func() error {
+				multi.HSet(key, createdField, now)
+				multi.PExpire(key, store.options.TTL)
+				return nil
+			})
+		}
+		multi.Close()
+		if err == nil && !has {
+			return sessionId, nil
+		}
+		if err != nil && err != redis.TxFailedErr {
+			return "", err
+		}
+	}
+	return "", ErrSessionIdConflict
+}
+
+// run commands add by fn in a transaction only if session exist, return ErrSessionNotFound if not
+// the key is WATCHed, so a session destroyed or expired after the check is never recreated without TTL,
+// transaction is retried if the session is changed by others before EXEC
+func (store *Store) update(sessionId string, fn func(multi *redis.Multi, key string)) error {
+	key := store.key(sessionId)
+	for i := 0; i < maxTxRetry; i++ {
+		multi, err := store.client.Watch(key)
+		if err != nil {
+			return err
+		}
+		has, err := multi.Exists(key).Result()
+		if err == nil && !has {
+			err = ErrSessionNotFound
+		}
+		if err == nil {
+			_, err = multi.Exec(func() error {
+				fn(multi, key)
+				return nil
+			})
+		}
+		multi.Close()
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+func (store *Store) Destory(sessionId string) error {
+	return store.client.Del(store.key(sessionId)).Err()
+}
+
+// rename old session to a new sessionId by RENAMENX, so never overwrite an exist session
+// metadata like user id is keep, and new sessionId replace the old one in user's index
+func (store *Store) Reset(oldSessionId string) (newSessionId string, err error) {
+	for i := 0; i < maxNewSessionRetry; i++ {
+		newSessionId, err = store.options.IDGenerator.NewID()
+		if err != nil {
+			return "", err
+		}
+		renamed, err := store.client.RenameNX(store.key(oldSessionId), store.key(newSessionId)).Result()
+		if err != nil {
+			if strings.Contains(err.Error(), "no such key") {
+				err = ErrSessionNotFound
+			}
+			return "", err
+		}
+		if renamed {
+			if err = store.client.PExpire(store.key(newSessionId), store.options.TTL).Err(); err != nil {
+				return "", err
+			}
+			return newSessionId, store.reindex(oldSessionId, newSessionId)
+		}
+	}
+	return "", ErrSessionIdConflict
+}
+
+// replace oldSessionId with newSessionId in the index of user the session tag with
+func (store *Store) reindex(oldSessionId string, newSessionId string) error {
+	userId, err := store.client.HGet(store.key(newSessionId), userField).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	multi := store.client.Multi()
+	defer multi.Close()
+	_, err = multi.Exec(func() error {
+		multi.SRem(store.userIndexKey(userId), oldSessionId)
+		multi.SAdd(store.userIndexKey(userId), newSessionId)
+		return nil
+	})
+	return err
+}
+
+// return false if session not exist or redis fail
+func (store *Store) Has(sessionId string) bool {
+	has, err := store.client.Exists(store.key(sessionId)).Result()
+	return err == nil && has
 }
 
-func (manager *redisSessionManager) Read(sessionId string) (wholeValue map[string]interface{}) {
-	//TODO
-	manager.redisClient.HMGet(sessionId).Result()
+// read whole session and refresh it's TTL
+// return nil if session not exist or redis fail, value can't be decode by Codec is ignored, like it's type is not registered any more
+func (store *Store) Read(sessionId string) (wholeValue map[string]interface{}) {
+	wholeValue, _ = store.read(sessionId)
 	return
 }
 
-func (manager *redisSessionManager) Write(sessionId string, changes map[string]interface{}) error {
-	//TODO
-	//for k, v := range changes {
-		//manager.redisClient.HMSet(sessionId, k, v)
-	//}
+func (store *Store) read(sessionId string) (map[string]interface{}, error) {
+	key := store.key(sessionId)
+	fields, err := store.client.HGetAllMap(key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	if err = store.client.PExpire(key, store.options.TTL).Err(); err != nil {
+		return nil, err
+	}
+	wholeValue := make(map[string]interface{}, len(fields))
+	for field, data := range fields {
+		if strings.HasPrefix(field, metaFieldPrefix) {
+			continue
+		}
+		// a value can't be decode should not make the whole session unreadable
+		if value, err := store.options.Codec.Unmarshal([]byte(data)); err == nil {
+			wholeValue[field] = value
+		}
+	}
+	return wholeValue, nil
+}
+
+// write changes to session hash and refresh it's TTL in a transaction
+func (store *Store) Write(sessionId string, changes map[string]interface{}) error {
+	pairs := make([]string, 0, len(changes)*2)
+	for field, value := range changes {
+		data, err := store.options.Codec.Marshal(value)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, field, string(data))
+	}
+	return store.update(sessionId, func(multi *redis.Multi, key string) {
+		if len(pairs) > 0 {
+			multi.HMSet(key, pairs[0], pairs[1], pairs[2:]...)
+		}
+		multi.PExpire(key, store.options.TTL)
+	})
+}
+
+// remove fields from session hash and refresh it's TTL in a transaction
+func (store *Store) Delete(sessionId string, names ...string) error {
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		// never remove fields used by redis_session itself
+		if !strings.HasPrefix(name, metaFieldPrefix) {
+			fields = append(fields, name)
+		}
+	}
+	return store.update(sessionId, func(multi *redis.Multi, key string) {
+		if len(fields) > 0 {
+			multi.HDel(key, fields...)
+		}
+		multi.PExpire(key, store.options.TTL)
+	})
+}
+
+// lock session by a lock key set by SET NX PX with a random token, so the lock works across processes share the redis
+// block until lock is acquired or ctx is done, the lock expire after Options.LockTTL if it's not unlocked
+func (store *Store) Lock(ctx context.Context, sessionId string) (unlock func(), err error) {
+	token, err := pong.RandomIDGenerator{}.NewID()
+	if err != nil {
+		return nil, err
+	}
+	key := store.key(sessionId) + lockKeySuffix
+	for {
+		locked, err := store.client.SetNX(key, token, store.options.LockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return func() {
+				store.unlock(key, token)
+			}, nil
+		}
+		select {
+		case <-time.After(lockRetryInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// remove lock key only if it's still hold by token, lock may has expired and been acquired by others
+// error is ignored because lock will expire after LockTTL
+func (store *Store) unlock(key string, token string) {
+	multi, err := store.client.Watch(key)
+	if err != nil {
+		return
+	}
+	defer multi.Close()
+	if value, err := multi.Get(key).Result(); err != nil || value != token {
+		return
+	}
+	multi.Exec(func() error {
+		multi.Del(key)
+		return nil
+	})
+}
+
+// set meta fields of a exist session
+func (store *Store) setMeta(sessionId string, pairs ...string) error {
+	return store.update(sessionId, func(multi *redis.Multi, key string) {
+		multi.HMSet(key, pairs[0], pairs[1], pairs[2:]...)
+	})
+}
+
+// read meta fields of session hash by HMGET, field not exist is not in the map
+func (store *Store) meta(key string) (map[string]string, error) {
+	values, err := store.client.HMGet(key, metaFields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(metaFields))
+	for i, value := range values {
+		if value, ok := value.(string); ok {
+			fields[metaFields[i]] = value
+		}
+	}
+	return fields, nil
+}
+
+// make SessionInfo from session hash's fields
+func sessionInfo(sessionId string, fields map[string]string) pong.SessionInfo {
+	info := pong.SessionInfo{
+		ID:        sessionId,
+		UserID:    fields[userField],
+		IP:        fields[ipField],
+		UserAgent: fields[userAgentField],
+	}
+	if created, err := strconv.ParseInt(fields[createdField], 10, 64); err == nil {
+		info.Created = time.Unix(created, 0)
+	}
+	info.LastSeen = info.Created
+	if seen, err := strconv.ParseInt(fields[seenField], 10, 64); err == nil {
+		info.LastSeen = time.Unix(0, seen)
+	}
+	return info
+}
+
+// escape glob chars in s so it can be used in SCAN MATCH pattern
+func escapePattern(s string) string {
+	escaped := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, s[i])
+	}
+	return string(escaped)
+}
+
+// return metadata of all sessions by SCAN keys with Prefix, it's O(N) so don't call it in every request
+// list sessions doesn't refresh their TTL
+func (store *Store) List(ctx context.Context) ([]pong.SessionInfo, error) {
+	infos := []pong.SessionInfo{}
+	pattern := escapePattern(store.options.Prefix) + "*"
+	var cursor int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		next, keys, err := store.client.Scan(cursor, pattern, scanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if strings.HasSuffix(key, lockKeySuffix) || strings.HasPrefix(key, store.options.Prefix+userIndexInfix) {
+				continue
+			}
+			fields, err := store.meta(key)
+			if err != nil {
+				return nil, err
+			}
+			// session may expire after SCAN, or key is not a session
+			if _, ok := fields[createdField]; !ok {
+				continue
+			}
+			infos = append(infos, sessionInfo(strings.TrimPrefix(key, store.options.Prefix), fields))
+		}
+		if cursor = next; cursor == 0 {
+			return infos, nil
+		}
+	}
+}
+
+func (store *Store) Count(ctx context.Context) (int, error) {
+	infos, err := store.List(ctx)
+	return len(infos), err
+}
+
+func (store *Store) Info(ctx context.Context, sessionId string) (*pong.SessionInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fields, err := store.meta(store.key(sessionId))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fields[createdField]; !ok {
+		return nil, nil
+	}
+	info := sessionInfo(sessionId, fields)
+	return &info, nil
+}
+
+func (store *Store) Revoke(ctx context.Context, match func(pong.SessionInfo) bool) (int, error) {
+	infos, err := store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, info := range infos {
+		if !match(info) {
+			continue
+		}
+		removed, err := store.client.Del(store.key(info.ID)).Result()
+		if err != nil {
+			return revoked, err
+		}
+		revoked += int(removed)
+	}
+	return revoked, nil
+}
+
+func (store *Store) Tag(ctx context.Context, sessionId string, userId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	oldUserId, err := store.client.HGet(store.key(sessionId), userField).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err = store.setMeta(sessionId, userField, userId); err != nil {
+		return err
+	}
+	multi := store.client.Multi()
+	defer multi.Close()
+	_, err = multi.Exec(func() error {
+		if len(oldUserId) > 0 && oldUserId != userId {
+			multi.SRem(store.userIndexKey(oldUserId), sessionId)
+		}
+		multi.SAdd(store.userIndexKey(userId), sessionId)
+		return nil
+	})
+	return err
+}
+
+// return metadata of sessions tag with userId by the user's index set
+// index doesn't expire with sessions, sessions expired or tag with other user are removed from it here
+func (store *Store) ListUser(ctx context.Context, userId string) ([]pong.SessionInfo, error) {
+	infos := []pong.SessionInfo{}
+	err := store.eachOfUser(ctx, userId, func(sessionId string, fields map[string]string) error {
+		infos = append(infos, sessionInfo(sessionId, fields))
+		return nil
+	})
+	return infos, err
+}
+
+// remove sessions tag with userId by the user's index set
+func (store *Store) RevokeUser(ctx context.Context, userId string) (int, error) {
+	revoked := 0
+	err := store.eachOfUser(ctx, userId, func(sessionId string, fields map[string]string) error {
+		removed, err := store.client.Del(store.key(sessionId)).Result()
+		revoked += int(removed)
+		if err == nil {
+			err = store.client.SRem(store.userIndexKey(userId), sessionId).Err()
+		}
+		return err
+	})
+	return revoked, err
+}
+
+// call fn with every session in userId's index which still exist and tag with userId, remove others from index
+func (store *Store) eachOfUser(ctx context.Context, userId string, fn func(sessionId string, fields map[string]string) error) error {
+	indexKey := store.userIndexKey(userId)
+	sessionIds, err := store.client.SMembers(indexKey).Result()
+	if err != nil {
+		return err
+	}
+	for _, sessionId := range sessionIds {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fields, err := store.meta(store.key(sessionId))
+		if err != nil {
+			return err
+		}
+		if _, ok := fields[createdField]; !ok || fields[userField] != userId {
+			if err := store.client.SRem(indexKey, sessionId).Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(sessionId, fields); err != nil {
+			return err
+		}
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+func (store *Store) Touch(ctx context.Context, sessionId string, ip string, userAgent string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := store.setMeta(sessionId, ipField, ip, userAgentField, userAgent, seenField, strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err == ErrSessionNotFound {
+		return nil
+	}
+	return err
+}
+
+// return a v2 pong.SessionStore backed by this store, every redis error is return
+// so when redis fail pong will give the error to HTTPErrorHandle instead of make a new session
+func (store *Store) SessionStore() pong.SessionStore {
+	return sessionStore{store}
+}
+
+type sessionStore struct {
+	store *Store
+}
+
+func (s sessionStore) IDGenerator() pong.IDGenerator {
+	return s.store.options.IDGenerator
+}
+
+func (s sessionStore) Lock(ctx context.Context, sessionId string) (func(), error) {
+	return s.store.Lock(ctx, sessionId)
+}
+
+func (s sessionStore) List(ctx context.Context) ([]pong.SessionInfo, error) {
+	return s.store.List(ctx)
+}
+
+func (s sessionStore) Count(ctx context.Context) (int, error) {
+	return s.store.Count(ctx)
+}
+
+func (s sessionStore) Info(ctx context.Context, sessionId string) (*pong.SessionInfo, error) {
+	return s.store.Info(ctx, sessionId)
+}
+
+func (s sessionStore) Revoke(ctx context.Context, match func(pong.SessionInfo) bool) (int, error) {
+	return s.store.Revoke(ctx, match)
+}
+
+func (s sessionStore) Tag(ctx context.Context, sessionId string, userId string) error {
+	return s.store.Tag(ctx, sessionId, userId)
+}
+
+func (s sessionStore) ListUser(ctx context.Context, userId string) ([]pong.SessionInfo, error) {
+	return s.store.ListUser(ctx, userId)
+}
+
+func (s sessionStore) RevokeUser(ctx context.Context, userId string) (int, error) {
+	return s.store.RevokeUser(ctx, userId)
+}
+
+func (s sessionStore) Touch(ctx context.Context, sessionId string, ip string, userAgent string) error {
+	return s.store.Touch(ctx, sessionId, ip, userAgent)
+}
+
+func (s sessionStore) NewSession(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return s.store.newSession()
+}
+
+func (s sessionStore) Destory(ctx context.Context, sessionId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.store.Destory(sessionId)
+}
+
+func (s sessionStore) Reset(ctx context.Context, oldSessionId string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return s.store.Reset(oldSessionId)
+}
+
+func (s sessionStore) Read(ctx context.Context, sessionId string) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	wholeValue, err := s.store.read(sessionId)
+	if err == ErrSessionNotFound {
+		return nil, nil
+	}
+	return wholeValue, err
+}
+
+func (s sessionStore) Write(ctx context.Context, sessionId string, changes map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.store.Write(sessionId, changes)
+}
+
+func (s sessionStore) Delete(ctx context.Context, sessionId string, names ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.store.Delete(sessionId, names...)
+}
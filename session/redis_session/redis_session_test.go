@@ -0,0 +1,266 @@
+package redis_session
+
+import (
+	"context"
+	"encoding/gob"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/_test"
+	"github.com/gwuhaolin/pong/pongtest"
+	"github.com/gwuhaolin/pong/session/codec"
+	"github.com/gwuhaolin/pong/session/sessiontest"
+	"gopkg.in/redis.v3"
+)
+
+func init() {
+	gob.Register(_test_util.TestUser{})
+}
+
+func newTestStore(options Options) (*Store, *fakeRedis) {
+	server := newFakeRedis()
+	return NewWithClient(server.client(), options), server
+}
+
+func TestReadWrite(t *testing.T) {
+	store, _ := newTestStore(Options{})
+	user := _test_util.TestUser{
+		Name:  "吴浩麟",
+		Age:   23,
+		Money: 123.456,
+		Alive: true,
+		Notes: []_test_util.TestNote{
+			{Text: "明天去放风筝"},
+		},
+	}
+	sid := store.NewSession()
+	if len(sid) == 0 || !store.Has(sid) {
+		t.Fatal("new session should exist")
+	}
+	if value := store.Read(sid); value == nil || len(value) != 0 {
+		t.Error("new session should be empty", value)
+	}
+	err := store.Write(sid, map[string]interface{}{
+		"name": "hal",
+		"age":  23,
+		"user": user,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := store.Read(sid)
+	if value["name"] != "hal" || value["age"] != 23 || !reflect.DeepEqual(value["user"], user) {
+		t.Error(value)
+	}
+	if err := store.Write("no-this", map[string]interface{}{"a": 1}); err != ErrSessionNotFound {
+		t.Error(err)
+	}
+	if store.Has("no-this") {
+		t.Error("write to not exist session should not create it")
+	}
+	if err := store.Destory(sid); err != nil {
+		t.Error(err)
+	}
+	if store.Has(sid) || store.Read(sid) != nil {
+		t.Error("session should be destoryed")
+	}
+}
+
+func TestKeyPrefixAndTTL(t *testing.T) {
+	store, server := newTestStore(Options{Prefix: "app:", TTL: time.Minute})
+	now := time.Now()
+	server.now = func() time.Time {
+		return now
+	}
+	sid := store.NewSession()
+	if server.items["app:"+sid] == nil {
+		t.Fatal("session should store with prefix")
+	}
+	now = now.Add(50 * time.Second)
+	// read refresh TTL
+	store.Read(sid)
+	now = now.Add(50 * time.Second)
+	if !store.Has(sid) {
+		t.Error("read should refresh TTL")
+	}
+	store.Write(sid, map[string]interface{}{"a": 1})
+	now = now.Add(50 * time.Second)
+	if !store.Has(sid) {
+		t.Error("write should refresh TTL")
+	}
+	now = now.Add(11 * time.Second)
+	if store.Has(sid) {
+		t.Error("session should expire")
+	}
+}
+
+func TestResetNotClobber(t *testing.T) {
+	store, _ := newTestStore(Options{})
+	other := store.NewSession()
+	store.Write(other, map[string]interface{}{"name": "other"})
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "mine"})
+	store.options.IDGenerator = &fakeIDGenerator{ids: []string{other, "fresh-id"}}
+	newSid, err := store.Reset(sid)
+	if err != nil || newSid != "fresh-id" {
+		t.Fatal(newSid, err)
+	}
+	if store.Read(other)["name"] != "other" {
+		t.Error("Reset should not clobber an exist session")
+	}
+	if store.Read(newSid)["name"] != "mine" || store.Has(sid) {
+		t.Error(store.Read(newSid))
+	}
+	if _, err := store.Reset("no-this"); err != ErrSessionNotFound {
+		t.Error(err)
+	}
+}
+
+func TestNewSessionAtomic(t *testing.T) {
+	store, server := newTestStore(Options{})
+	other := store.NewSession()
+	store.Write(other, map[string]interface{}{"name": "other"})
+	store.options.IDGenerator = &fakeIDGenerator{ids: []string{other, "fresh-id"}}
+	if sid := store.NewSession(); sid != "fresh-id" {
+		t.Fatal(sid)
+	}
+	if store.Read(other)["name"] != "other" {
+		t.Error("NewSession should not overwrite an exist session")
+	}
+	// session is create with TTL in one transaction
+	if server.items[store.key("fresh-id")].expireAt.IsZero() {
+		t.Error("new session should has TTL")
+	}
+}
+
+func TestWriteDestroyedSession(t *testing.T) {
+	store, server := newTestStore(Options{})
+	sid := store.NewSession()
+	err := store.update(sid, func(multi *redis.Multi, key string) {
+		// session is destroyed by others after it's checked exist
+		store.client.Del(key)
+		multi.HSet(key, "name", "吴浩麟")
+	})
+	if err != ErrSessionNotFound || server.items[store.key(sid)] != nil {
+		t.Error("destroyed session should not be recreated", err)
+	}
+}
+
+func TestReadUndecodableValue(t *testing.T) {
+	store, _ := newTestStore(Options{})
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟"})
+	store.client.HSet(store.key(sid), "broken", "not gob")
+	wholeValue, err := store.SessionStore().Read(context.Background(), sid)
+	if err != nil || !reflect.DeepEqual(wholeValue, map[string]interface{}{"name": "吴浩麟"}) {
+		t.Error(wholeValue, err)
+	}
+}
+
+func TestRedisError(t *testing.T) {
+	store, server := newTestStore(Options{})
+	sid := store.NewSession()
+	server.close()
+	if err := store.Write(sid, map[string]interface{}{"a": 1}); err == nil {
+		t.Error("redis error should return")
+	}
+	if err := store.Destory(sid); err == nil {
+		t.Error("redis error should return")
+	}
+	if _, err := store.Reset(sid); err == nil {
+		t.Error("redis error should return")
+	}
+	if store.NewSession() != "" {
+		t.Error("new session should fail")
+	}
+}
+
+func TestSessionWithPong(t *testing.T) {
+	store, _ := newTestStore(Options{})
+	po := pong.New()
+	po.EnableSession(store)
+	po.Root.Get("/set", func(c *pong.Context) {
+		c.Session.Set(map[string]interface{}{"name": "吴浩麟"})
+		c.Response.String("")
+	})
+	po.Root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	client := pongtest.New(t, po)
+	client.Get("/set").Do().AssertStatus(http.StatusOK)
+	client.Get("/get").Do().AssertBody("吴浩麟")
+}
+
+func TestSuite(t *testing.T) {
+	sessiontest.Run(t, func() pong.SessionIO {
+		store, _ := newTestStore(Options{})
+		return store
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, sessionCodec := range map[string]pong.SessionCodec{"Gob": codec.Gob{}, "JSON": codec.JSON{}, "MsgPack": codec.MsgPack{}} {
+		t.Run(name, func(t *testing.T) {
+			sessiontest.RunStoreRoundTrip(t, func() pong.SessionStore {
+				store, _ := newTestStore(Options{Codec: sessionCodec})
+				return store.SessionStore()
+			})
+		})
+	}
+}
+
+func TestSessionStoreSuite(t *testing.T) {
+	sessiontest.RunStore(t, func() pong.SessionStore {
+		store, _ := newTestStore(Options{})
+		return store.SessionStore()
+	})
+}
+
+func TestSessionStoreError(t *testing.T) {
+	store, server := newTestStore(Options{})
+	po := pong.New()
+	po.EnableSessionStore(store.SessionStore())
+	po.HTTPErrorHandle = func(err error, c *pong.Context) {
+		c.Response.StatusCode = http.StatusServiceUnavailable
+		c.Response.String("session store fail")
+	}
+	po.Root.Get("/set", func(c *pong.Context) {
+		c.Session.Set(map[string]interface{}{"name": "吴浩麟"})
+		c.Response.String("")
+	})
+	po.Root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	client := pongtest.New(t, po)
+	client.Get("/set").Do().AssertStatus(http.StatusOK)
+	sid := client.Cookie(pong.SessionCookiesName).Value
+	server.close()
+	res := client.Get("/get").Do().AssertStatus(http.StatusServiceUnavailable).AssertBody("session store fail")
+	if cookies := res.Cookies(); len(cookies) != 0 {
+		t.Error("new session should not be make when redis fail", cookies)
+	}
+	if cookie := client.Cookie(pong.SessionCookiesName); cookie == nil || cookie.Value != sid {
+		t.Error("session cookie should be keep", cookie)
+	}
+}
+
+// generate ids in order, then "another-id"
+type fakeIDGenerator struct {
+	ids []string
+}
+
+func (g *fakeIDGenerator) NewID() (string, error) {
+	if len(g.ids) == 0 {
+		return "another-id", nil
+	}
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+func (g *fakeIDGenerator) Valid(id string) bool {
+	return true
+}
@@ -0,0 +1,128 @@
+package sessiontest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/session/codec"
+)
+
+// Struct is a custom struct registered by codec.Register, it's used by round trip test
+type Struct struct {
+	Name    string
+	Age     int
+	Tags    []string
+	Created time.Time
+	Next    *Struct
+}
+
+func init() {
+	codec.Register(Struct{})
+}
+
+// return values of build in and custom types used by round trip test, every call return a new map
+func Values() map[string]interface{} {
+	created := time.Date(2017, 1, 2, 3, 4, 5, 6, time.UTC)
+	return map[string]interface{}{
+		"string":   "吴浩麟",
+		"empty":    "",
+		"bool":     true,
+		"int":      23,
+		"int8":     int8(-8),
+		"int16":    int16(-16),
+		"int32":    int32(-32),
+		"int64":    int64(-1 << 40),
+		"uint":     uint(1),
+		"uint8":    uint8(255),
+		"uint16":   uint16(65535),
+		"uint32":   uint32(1<<32 - 1),
+		"uint64":   uint64(1<<64 - 1),
+		"float32":  float32(1.5),
+		"float64":  123.456,
+		"bytes":    []byte{0, 1, 2},
+		"strings":  []string{"a", "b"},
+		"map":      map[string]string{"k": "v"},
+		"time":     created,
+		"duration": time.Minute,
+		"struct": Struct{
+			Name:    "吴浩麟",
+			Age:     23,
+			Tags:    []string{"go"},
+			Created: created,
+			Next:    &Struct{Name: "halwu"},
+		},
+		"nested": map[string]interface{}{
+			"int":  1,
+			"list": []interface{}{"a", 2, 3.5, nil},
+		},
+	}
+}
+
+// check every value in Values come back with the same type and value after encode and decode by sessionCodec,
+// both one by one and as a whole session
+func RunCodec(t *testing.T, sessionCodec pong.SessionCodec) {
+	values := Values()
+	for name, value := range values {
+		data, err := sessionCodec.Marshal(value)
+		if err != nil {
+			t.Errorf("%s: marshal %T fail: %v", name, value, err)
+			continue
+		}
+		decoded, err := sessionCodec.Unmarshal(data)
+		if err != nil {
+			t.Errorf("%s: unmarshal %T fail: %v", name, value, err)
+			continue
+		}
+		assertSame(t, name, value, decoded)
+	}
+	data, err := sessionCodec.Marshal(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := sessionCodec.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSame(t, "whole session", values, decoded)
+	if _, err = sessionCodec.Unmarshal([]byte("not encoded by codec")); err == nil {
+		t.Error("unmarshal invalid data should return error")
+	}
+}
+
+// check every value in Values come back with the same type and value after write to and read from store,
+// newStore should return a new empty store every time it's called
+func RunRoundTrip(t *testing.T, newStore func() pong.SessionIO) {
+	RunStoreRoundTrip(t, func() pong.SessionStore {
+		return pong.AdaptSessionIO(newStore())
+	})
+}
+
+// works like RunRoundTrip but for v2 SessionStore
+func RunStoreRoundTrip(t *testing.T, newSessionStore func() pong.SessionStore) {
+	store := &suiteStore{t: t, store: newSessionStore()}
+	sid := store.NewSession()
+	values := Values()
+	if err := store.Write(sid, values); err != nil {
+		t.Fatal(err)
+	}
+	// write again so value has been merged is checked
+	if err := store.Write(sid, map[string]interface{}{"string": values["string"]}); err != nil {
+		t.Fatal(err)
+	}
+	read := store.Read(sid)
+	for name, value := range values {
+		assertSame(t, name, value, read[name])
+	}
+	if len(read) != len(values) {
+		t.Error("read values should be the same as write", len(read), len(values))
+	}
+}
+
+func assertSame(t *testing.T, name string, expected interface{}, actual interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("%s: want %T %#v, got %T %#v", name, expected, expected, actual, actual)
+	}
+}
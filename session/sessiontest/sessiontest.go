@@ -0,0 +1,533 @@
+/*
+sessiontest is a test suite every pong.SessionIO and pong.SessionStore should pass, it test the store itself and how it works with pong.
+
+Example:
+
+	func TestSuite(t *testing.T) {
+		sessiontest.Run(t, func() pong.SessionIO {
+			return my_session.New()
+		})
+	}
+
+use RunStore to test a v2 pong.SessionStore.
+if the store is a pong.SessionLocker, it's lock is also tested.
+if the store is a pong.SessionAdmin, it's admin API and the router mount by pong.MountSessionAdmin are also tested.
+
+values in the suite are strings and numbers, number is read by Session.GetInt,
+so a store which change number's type like JSON can also pass.
+*/
+package sessiontest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gwuhaolin/pong"
+	"github.com/gwuhaolin/pong/pongtest"
+)
+
+// run the whole suite, newStore should return a new empty store every time it's called
+func Run(t *testing.T, newStore func() pong.SessionIO) {
+	RunStore(t, func() pong.SessionStore {
+		return pong.AdaptSessionIO(newStore())
+	})
+}
+
+// run the whole suite for v2 SessionStore, newStore should return a new empty store every time it's called
+func RunStore(t *testing.T, newSessionStore func() pong.SessionStore) {
+	newStore := func(t *testing.T) *suiteStore {
+		return &suiteStore{t: t, store: newSessionStore()}
+	}
+	t.Run("NewSession", func(t *testing.T) {
+		testNewSession(t, newStore(t))
+	})
+	t.Run("ReadWrite", func(t *testing.T) {
+		testReadWrite(t, newStore(t))
+	})
+	t.Run("Reset", func(t *testing.T) {
+		testReset(t, newStore(t))
+	})
+	t.Run("Destory", func(t *testing.T) {
+		testDestory(t, newStore(t))
+	})
+	t.Run("Delete", func(t *testing.T) {
+		testDelete(t, newStore(t))
+	})
+	t.Run("NoSession", func(t *testing.T) {
+		testNoSession(t, newStore(t))
+	})
+	t.Run("UpdateSessionValue", func(t *testing.T) {
+		testUpdateSessionValue(t, newStore(t))
+	})
+	t.Run("ResetSession", func(t *testing.T) {
+		testResetSession(t, newStore(t))
+	})
+	t.Run("DestorySession", func(t *testing.T) {
+		testDestorySession(t, newStore(t))
+	})
+	t.Run("CheaterSession", func(t *testing.T) {
+		testCheaterSession(t, newStore(t))
+	})
+	t.Run("DeleteSessionValue", func(t *testing.T) {
+		testDeleteSessionValue(t, newStore(t))
+	})
+	t.Run("Flash", func(t *testing.T) {
+		testFlash(t, newStore(t))
+	})
+	t.Run("Lock", func(t *testing.T) {
+		testLock(t, newStore(t))
+	})
+	t.Run("Admin", func(t *testing.T) {
+		testAdmin(t, newStore(t))
+	})
+}
+
+// suiteStore call SessionStore with a background context, test fail if NewSession or Read return error
+type suiteStore struct {
+	t     *testing.T
+	store pong.SessionStore
+}
+
+func (s *suiteStore) NewSession() string {
+	s.t.Helper()
+	sessionId, err := s.store.NewSession(context.Background())
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return sessionId
+}
+
+func (s *suiteStore) Read(sessionId string) map[string]interface{} {
+	s.t.Helper()
+	wholeValue, err := s.store.Read(context.Background(), sessionId)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return wholeValue
+}
+
+func (s *suiteStore) Has(sessionId string) bool {
+	s.t.Helper()
+	return s.Read(sessionId) != nil
+}
+
+func (s *suiteStore) Write(sessionId string, changes map[string]interface{}) error {
+	return s.store.Write(context.Background(), sessionId, changes)
+}
+
+func (s *suiteStore) Reset(oldSessionId string) (string, error) {
+	return s.store.Reset(context.Background(), oldSessionId)
+}
+
+func (s *suiteStore) Destory(sessionId string) error {
+	return s.store.Destory(context.Background(), sessionId)
+}
+
+func (s *suiteStore) Delete(sessionId string, names ...string) error {
+	return s.store.Delete(context.Background(), sessionId, names...)
+}
+
+func testNewSession(t *testing.T, store *suiteStore) {
+	ids := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		sid := store.NewSession()
+		if len(sid) == 0 || ids[sid] {
+			t.Fatal("sessionId should be unique", sid)
+		}
+		ids[sid] = true
+		if !store.Has(sid) {
+			t.Error("new session should exist", sid)
+		}
+		if value := store.Read(sid); value == nil || len(value) != 0 {
+			t.Error("new session should be empty", value)
+		}
+	}
+	if store.Has("no-this-session") || store.Read("no-this-session") != nil {
+		t.Error("session not exist should not be find")
+	}
+}
+
+func testReadWrite(t *testing.T, store *suiteStore) {
+	sid := store.NewSession()
+	if err := store.Write(sid, map[string]interface{}{"name": "吴浩麟", "city": "深圳"}); err != nil {
+		t.Fatal(err)
+	}
+	// only changes are give to Write, other values should be keep
+	if err := store.Write(sid, map[string]interface{}{"name": "halwu"}); err != nil {
+		t.Fatal(err)
+	}
+	value := store.Read(sid)
+	if len(value) != 2 || value["name"] != "halwu" || value["city"] != "深圳" {
+		t.Error(value)
+	}
+	// change the value read out should not affect store
+	value["name"] = "changed"
+	if store.Read(sid)["name"] != "halwu" {
+		t.Error("value read out should be a copy")
+	}
+	if err := store.Write("no-this-session", map[string]interface{}{"name": "halwu"}); err == nil {
+		t.Error("write to session not exist should return error")
+	}
+	if store.Has("no-this-session") {
+		t.Error("write should not make a session")
+	}
+}
+
+func testReset(t *testing.T, store *suiteStore) {
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟"})
+	newSid, err := store.Reset(sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newSid == sid || store.Has(sid) || store.Read(sid) != nil {
+		t.Error("old session should be removed after reset")
+	}
+	if value := store.Read(newSid); value["name"] != "吴浩麟" {
+		t.Error(value)
+	}
+	if _, err = store.Reset("no-this-session"); err == nil {
+		t.Error("reset session not exist should return error")
+	}
+}
+
+func testDestory(t *testing.T, store *suiteStore) {
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟"})
+	if err := store.Destory(sid); err != nil {
+		t.Fatal(err)
+	}
+	if store.Has(sid) || store.Read(sid) != nil {
+		t.Error("session should be removed after destory")
+	}
+	if err := store.Destory(sid); err != nil {
+		t.Error("destory session not exist should not return error", err)
+	}
+}
+
+func testDelete(t *testing.T, store *suiteStore) {
+	sid := store.NewSession()
+	store.Write(sid, map[string]interface{}{"name": "吴浩麟", "city": "深圳", "age": 23})
+	if err := store.Delete(sid, "name", "age", "no-this-name"); err != nil {
+		t.Fatal(err)
+	}
+	if value := store.Read(sid); len(value) != 1 || value["city"] != "深圳" {
+		t.Error(value)
+	}
+	if err := store.Delete("no-this-session", "city"); err == nil {
+		t.Error("delete from session not exist should return error")
+	}
+}
+
+func newPong(store *suiteStore) *pong.Pong {
+	po := pong.New()
+	po.EnableSessionStore(store.store)
+	root := po.Root
+	root.Get("/get", func(c *pong.Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	root.Get("/set", func(c *pong.Context) {
+		err := c.Session.Set(map[string]interface{}{
+			"name": c.Request.Query("name"),
+			"age":  23,
+		})
+		if err != nil {
+			c.Response.StatusCode = http.StatusInternalServerError
+		}
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	root.Get("/reset", func(c *pong.Context) {
+		if err := c.ResetSession(); err != nil {
+			c.Response.StatusCode = http.StatusInternalServerError
+		}
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	root.Get("/delete", func(c *pong.Context) {
+		c.Session.Delete(c.Request.Query("name"))
+		c.Response.String(strings.Join(c.Session.Keys(), ","))
+	})
+	root.Get("/clear", func(c *pong.Context) {
+		c.Session.Clear()
+		c.Response.String(strings.Join(c.Session.Keys(), ","))
+	})
+	root.Get("/flash", func(c *pong.Context) {
+		if message := c.Request.Query("message"); len(message) > 0 {
+			c.Session.AddFlash(message)
+		}
+		c.Response.String(strings.Join(c.Session.Flashes(), ","))
+	})
+	root.Get("/addFlash", func(c *pong.Context) {
+		c.Session.AddFlash(c.Request.Query("message"))
+		c.Response.String("")
+	})
+	root.Get("/destory", func(c *pong.Context) {
+		if err := c.DestorySession(); err != nil {
+			c.Response.StatusCode = http.StatusInternalServerError
+		}
+		c.Response.String("")
+	})
+	return po
+}
+
+func sessionCookie(t *testing.T, res *pongtest.Response) *http.Cookie {
+	t.Helper()
+	cookie := res.Cookie(pong.SessionCookiesName)
+	if cookie == nil {
+		t.Fatal("session cookie should be set", res.Cookies())
+	}
+	return cookie
+}
+
+func testNoSession(t *testing.T, store *suiteStore) {
+	client := pongtest.New(t, newPong(store))
+	// session not changed, no cookie is set
+	if cookies := client.Get("/get").Do().AssertStatus(http.StatusOK).Cookies(); len(cookies) != 0 {
+		t.Error("session cookie should not be set if session has no change", cookies)
+	}
+	sid := sessionCookie(t, client.Get("/set").Query("name", "吴浩麟").Do().AssertStatus(http.StatusOK)).Value
+	if !store.Has(sid) {
+		t.Error("session should be make when session has changes")
+	}
+}
+
+func testUpdateSessionValue(t *testing.T, store *suiteStore) {
+	client := pongtest.New(t, newPong(store))
+	sid := sessionCookie(t, client.Get("/set").Query("name", "吴浩麟").Do().AssertStatus(http.StatusOK)).Value
+	client.Get("/get").Do().AssertBody("吴浩麟")
+	client.Get("/set").Query("name", "halwu").Do().AssertStatus(http.StatusOK)
+	client.Get("/get").Do().AssertBody("halwu")
+	value := store.Read(sid)
+	if value["name"] != "halwu" {
+		t.Error(value)
+	}
+	po := pong.New()
+	po.EnableSessionStore(store.store)
+	po.Root.Get("/age", func(c *pong.Context) {
+		if age := c.Session.GetInt("age", 0); age != 23 {
+			t.Error(age)
+		}
+	})
+	pongtest.New(t, po).Get("/age").Cookie(&http.Cookie{Name: pong.SessionCookiesName, Value: sid}).Do()
+}
+
+func testResetSession(t *testing.T, store *suiteStore) {
+	client := pongtest.New(t, newPong(store))
+	sid := sessionCookie(t, client.Get("/set").Query("name", "吴浩麟").Do()).Value
+	newSid := sessionCookie(t, client.Get("/reset").Do().AssertStatus(http.StatusOK).AssertBody("吴浩麟")).Value
+	if newSid == sid || store.Has(sid) {
+		t.Error("old session should be removed after reset")
+	}
+	client.Get("/get").Do().AssertBody("吴浩麟")
+}
+
+func testDestorySession(t *testing.T, store *suiteStore) {
+	client := pongtest.New(t, newPong(store))
+	sid := sessionCookie(t, client.Get("/set").Query("name", "吴浩麟").Do()).Value
+	cookie := sessionCookie(t, client.Get("/destory").Do().AssertStatus(http.StatusOK))
+	if cookie.MaxAge >= 0 {
+		t.Error("session cookie should be removed", cookie)
+	}
+	if store.Has(sid) {
+		t.Error("session should be removed after destory")
+	}
+	client.Get("/get").Do().AssertBody("")
+}
+
+func testCheaterSession(t *testing.T, store *suiteStore) {
+	client := pongtest.New(t, newPong(store))
+	cheaterSid := "cheaterSid-cheaterSid"
+	cheaterCookie := &http.Cookie{Name: pong.SessionCookiesName, Value: cheaterSid}
+	client.Get("/get").Cookie(cheaterCookie).Do().AssertBody("")
+	res := client.Get("/set").Query("name", "吴浩麟").Cookie(cheaterCookie).Do()
+	if sid := sessionCookie(t, res).Value; sid == cheaterSid {
+		t.Error("sessionId not exist in store should not be used")
+	}
+	if store.Has(cheaterSid) {
+		t.Error("sessionId give by client should not be store")
+	}
+}
+
+func testDeleteSessionValue(t *testing.T, store *suiteStore) {
+	client := pongtest.New(t, newPong(store))
+	sid := sessionCookie(t, client.Get("/set").Query("name", "吴浩麟").Do()).Value
+	client.Get("/delete").Query("name", "name").Do().AssertBody("age")
+	if value := store.Read(sid); len(value) != 1 || value["name"] != nil {
+		t.Error("delete should reach session manager", value)
+	}
+	client.Get("/get").Do().AssertBody("")
+	client.Get("/set").Query("name", "吴浩麟").Do()
+	client.Get("/clear").Do().AssertBody("")
+	if value := store.Read(sid); value == nil || len(value) != 0 {
+		t.Error("clear should remove all values but keep session", value)
+	}
+}
+
+func testFlash(t *testing.T, store *suiteStore) {
+	client := pongtest.New(t, newPong(store))
+	client.Get("/addFlash").Query("message", "saved").Do()
+	client.Get("/addFlash").Query("message", "sent").Do()
+	// flash messages can only be read once
+	client.Get("/flash").Do().AssertBody("saved,sent")
+	client.Get("/flash").Do().AssertBody("")
+	// flash add and read in same request
+	client.Get("/flash").Query("message", "now").Do().AssertBody("now")
+	client.Get("/flash").Do().AssertBody("")
+}
+
+// skip if store is not a SessionLocker
+func testLock(t *testing.T, store *suiteStore) {
+	locker := pong.SessionLockerOf(store.store)
+	if locker == nil {
+		t.Skip("store is not a pong.SessionLocker")
+	}
+	sid := store.NewSession()
+	unlock, err := locker.Lock(context.Background(), sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	if _, err = locker.Lock(ctx, sid); err != context.DeadlineExceeded {
+		t.Error("lock a locked session should wait until ctx is done", err)
+	}
+	cancel()
+	// other session is not affected
+	otherUnlock, err := locker.Lock(context.Background(), store.NewSession())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherUnlock()
+	unlock()
+	if unlock, err = locker.Lock(context.Background(), sid); err != nil {
+		t.Fatal("lock should be acquired after unlock", err)
+	}
+	unlock()
+
+	// concurrent read-modify-write of the same session should not lose update
+	po := pong.New()
+	po.EnableSessionStore(store.store, pong.SessionOptions{Lock: true})
+	po.Root.Get("/incr", func(c *pong.Context) {
+		count := c.Session.GetInt("count", 0)
+		// make the race window large
+		time.Sleep(time.Millisecond)
+		c.Session.Put("count", count+1)
+		c.Response.String("")
+	})
+	client := pongtest.New(t, po)
+	cookie := &http.Cookie{Name: pong.SessionCookiesName, Value: sid}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Get("/incr").Cookie(cookie).Do().AssertStatus(http.StatusOK)
+		}()
+	}
+	wg.Wait()
+	po.Root.Get("/count", func(c *pong.Context) {
+		if count := c.Session.GetInt("count", 0); count != 20 {
+			t.Error("update should not be lost", count)
+		}
+	})
+	client.Get("/count").Cookie(cookie).Do()
+}
+
+// skip if store is not a SessionAdmin
+func testAdmin(t *testing.T, store *suiteStore) {
+	admin := pong.SessionAdminOf(store.store)
+	if admin == nil {
+		t.Skip("store is not a pong.SessionAdmin")
+	}
+	ctx := context.Background()
+	po := newPong(store)
+	po.Root.Get("/login", func(c *pong.Context) {
+		if err := c.TagSession(c.Request.Query("user")); err != nil {
+			t.Error(err)
+		}
+		c.Response.String(c.Session.ID())
+	})
+	pong.MountSessionAdmin(po.Root.Router("/admin"), admin)
+	login := func(user string) (*pongtest.Client, string) {
+		client := pongtest.New(t, po)
+		sid := client.Get("/login").Query("user", user).Header("User-Agent", "sessiontest").Do().AssertStatus(http.StatusOK).String()
+		return client, sid
+	}
+	alice, aliceSid := login("alice")
+	_, aliceSid2 := login("alice")
+	_, bobSid := login("bob")
+	untagged := store.NewSession()
+	adminClient := pongtest.New(t, po)
+
+	if count, err := admin.Count(ctx); err != nil || count != 4 {
+		t.Error(count, err)
+	}
+	info, err := admin.Info(ctx, aliceSid)
+	if err != nil || info == nil {
+		t.Fatal(info, err)
+	}
+	if info.ID != aliceSid || info.UserID != "alice" || info.UserAgent != "sessiontest" || len(info.IP) == 0 ||
+		info.Created.IsZero() || info.LastSeen.Before(info.Created) {
+		t.Error(info)
+	}
+	if info, err = admin.Info(ctx, "not-exist"); err != nil || info != nil {
+		t.Error(info, err)
+	}
+	infos, err := admin.List(ctx)
+	if err != nil || len(infos) != 4 {
+		t.Error(infos, err)
+	}
+
+	var listed []pong.SessionInfo
+	adminClient.Get("/admin/sessions").Do().AssertStatus(http.StatusOK).BindJSON(&listed)
+	for _, info := range listed {
+		if info.ID == aliceSid || info.ID == aliceSid2 || info.ID == bobSid || info.ID == untagged {
+			t.Error("sessionId should not be listed", info)
+		}
+	}
+	if len(listed) != 4 {
+		t.Error(listed)
+	}
+	adminClient.Get("/admin/sessions").Query("user", "alice").Do().AssertStatus(http.StatusOK).BindJSON(&listed)
+	if len(listed) != 2 || listed[0].UserID != "alice" || listed[1].UserID != "alice" {
+		t.Error(listed)
+	}
+	adminClient.Get("/admin/sessions/count").Do().AssertJSON(map[string]int{"count": 4})
+	var inspected pong.SessionInfo
+	adminClient.Get("/admin/sessions/" + pong.SessionIDHash(bobSid)).Do().AssertStatus(http.StatusOK).BindJSON(&inspected)
+	if inspected.ID != pong.SessionIDHash(bobSid) || inspected.UserID != "bob" {
+		t.Error(inspected)
+	}
+	adminClient.Get("/admin/sessions/" + bobSid).Do().AssertStatus(http.StatusNotFound)
+	adminClient.Get("/admin/sessions/not-exist").Do().AssertStatus(http.StatusNotFound)
+	adminClient.Put("/admin/sessions/"+pong.SessionIDHash(untagged)+"/user").Query("user", "carol").Do().AssertStatus(http.StatusOK)
+	adminClient.Put("/admin/sessions/not-exist/user").Query("user", "carol").Do().AssertStatus(http.StatusNotFound)
+	// sessionId reset keep it's user
+	newAliceSid, err := store.Reset(aliceSid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceSid2 = newAliceSid
+	if infos, err := pong.ListSessionsOfUser(ctx, admin, "alice"); err != nil || len(infos) != 2 {
+		t.Error(infos, err)
+	}
+
+	// kill all sessions of alice
+	adminClient.Delete("/admin/sessions").Do().AssertStatus(http.StatusBadRequest)
+	adminClient.Delete("/admin/sessions").Query("user", "alice").Do().AssertStatus(http.StatusOK).AssertJSON(map[string]int{"revoked": 2})
+	if store.Has(aliceSid) || store.Has(aliceSid2) || !store.Has(bobSid) {
+		t.Error("only sessions of alice should be revoked")
+	}
+	alice.Get("/get").Do().AssertBody("")
+	adminClient.Delete("/admin/sessions/" + bobSid).Do().AssertStatus(http.StatusNotFound)
+	adminClient.Delete("/admin/sessions/" + pong.SessionIDHash(bobSid)).Do().AssertStatus(http.StatusOK).AssertJSON(map[string]int{"revoked": 1})
+	adminClient.Delete("/admin/sessions/" + pong.SessionIDHash(bobSid)).Do().AssertStatus(http.StatusNotFound)
+	if revoked, err := pong.RevokeSessionsOfUser(ctx, admin, "carol"); err != nil || revoked != 1 {
+		t.Error(revoked, err)
+	}
+	if count, err := admin.Count(ctx); err != nil || count != 0 {
+		t.Error(count, err)
+	}
+}
@@ -0,0 +1,313 @@
+package pong
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// this error will be return by TagSession when session store is not a SessionAdmin
+var ErrorNoSessionAdmin = errors.New("session manager is not a SessionAdmin")
+
+// SessionInfo is metadata of a session, it has no session value
+type SessionInfo struct {
+	ID string `json:"id"`
+	// user id tag by SessionAdmin.Tag, empty if session is not tagged
+	UserID string `json:"userId,omitempty"`
+	// when session is created
+	Created time.Time `json:"created"`
+	// when session is last accessed
+	LastSeen time.Time `json:"lastSeen"`
+	// client's IP and User-Agent when session is last accessed
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// SessionAdmin is an optional interface a SessionIO or SessionStore can implement to enumerate and manage sessions,
+// like kill all sessions of a user for security incidents
+// if session store is a SessionAdmin, pong will Touch session with client's IP and User-Agent when it's accessed
+type SessionAdmin interface {
+	// return metadata of all sessions not expired
+	List(ctx context.Context) ([]SessionInfo, error)
+	// return how many sessions not expired
+	Count(ctx context.Context) (int, error)
+	// return metadata of a session, return nil if session is not exist
+	Info(ctx context.Context, sessionId string) (*SessionInfo, error)
+	// remove every session match return true, return how many sessions are removed
+	Revoke(ctx context.Context, match func(SessionInfo) bool) (int, error)
+	// tag a session with user id, so sessions can be find and revoke by user
+	Tag(ctx context.Context, sessionId string, userId string) error
+	// update session's last seen time, client's IP and User-Agent, session not exist should be ignore
+	Touch(ctx context.Context, sessionId string, ip string, userAgent string) error
+}
+
+// SessionUserIndex is an optional interface a SessionAdmin can implement to keep an index from user id to sessions tag with it,
+// so sessions of a user can be find and revoke without List all sessions
+type SessionUserIndex interface {
+	// return metadata of all sessions not expired tag with userId
+	ListUser(ctx context.Context, userId string) ([]SessionInfo, error)
+	// remove all sessions tag with userId, return how many sessions are removed
+	RevokeUser(ctx context.Context, userId string) (int, error)
+}
+
+// return the SessionAdmin implement by store, v1 SessionIO adapt by AdaptSessionIO is unwrapped
+// return nil if store can't manage sessions
+func SessionAdminOf(store SessionStore) SessionAdmin {
+	if adapter, ok := store.(sessionIOAdapter); ok {
+		admin, _ := adapter.SessionIO.(SessionAdmin)
+		return admin
+	}
+	admin, _ := store.(SessionAdmin)
+	return admin
+}
+
+// return the SessionAdmin of session store enabled by EnableSession or EnableSessionStore, nil if it's not a SessionAdmin
+func (pong *Pong) SessionAdmin() SessionAdmin {
+	return pong.sessionAdmin
+}
+
+// return a match function for SessionAdmin.Revoke which match all sessions tag with userId
+func SessionsOfUser(userId string) func(SessionInfo) bool {
+	return func(info SessionInfo) bool {
+		return info.UserID == userId
+	}
+}
+
+// return metadata of all sessions tag with userId, by admin's SessionUserIndex if it has one, else by filter List
+func ListSessionsOfUser(ctx context.Context, admin SessionAdmin, userId string) ([]SessionInfo, error) {
+	if index, ok := admin.(SessionUserIndex); ok {
+		return index.ListUser(ctx, userId)
+	}
+	infos, err := admin.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	match := SessionsOfUser(userId)
+	filtered := make([]SessionInfo, 0, len(infos))
+	for _, info := range infos {
+		if match(info) {
+			filtered = append(filtered, info)
+		}
+	}
+	return filtered, nil
+}
+
+// remove all sessions tag with userId, by admin's SessionUserIndex if it has one, else by Revoke with SessionsOfUser
+// call it to kill all sessions of a user like when password is changed
+func RevokeSessionsOfUser(ctx context.Context, admin SessionAdmin, userId string) (int, error) {
+	if index, ok := admin.(SessionUserIndex); ok {
+		return index.RevokeUser(ctx, userId)
+	}
+	return admin.Revoke(ctx, SessionsOfUser(userId))
+}
+
+// return a hash of sessionId used as id in the API mount by MountSessionAdmin
+// sessionId can be used to hijack the session, so it's never show to anyone, even admin
+func SessionIDHash(sessionId string) string {
+	sum := sha256.Sum256([]byte(sessionId))
+	return hex.EncodeToString(sum[:16])
+}
+
+// client's IP is the host of request's RemoteAddr
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// sessionTouches remember when each session is last touched, so a session is touched at most once every interval
+type sessionTouches struct {
+	lock      sync.Mutex
+	interval  time.Duration
+	last      map[string]time.Time
+	lastSweep time.Time
+}
+
+func newSessionTouches(interval time.Duration) *sessionTouches {
+	return &sessionTouches{
+		interval: interval,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// return whether the session should be touched now, if so remember now as it's last touch time
+func (touches *sessionTouches) allow(sessionId string, now time.Time) bool {
+	touches.lock.Lock()
+	defer touches.lock.Unlock()
+	// forget sessions not touched in interval, they will be touched at next access
+	if now.Sub(touches.lastSweep) >= touches.interval {
+		for id, last := range touches.last {
+			if now.Sub(last) >= touches.interval {
+				delete(touches.last, id)
+			}
+		}
+		touches.lastSweep = now
+	}
+	if last, has := touches.last[sessionId]; has && now.Sub(last) < touches.interval {
+		return false
+	}
+	touches.last[sessionId] = now
+	return true
+}
+
+// record client's IP and User-Agent to session's metadata, error is ignored because metadata is not critical
+// a session is touched at most once every SessionOptions.TouchInterval
+func (s *Session) touch() {
+	admin := s.pong.sessionAdmin
+	if admin == nil || len(s.id) == 0 {
+		return
+	}
+	if touches := s.pong.sessionTouches; touches != nil && !touches.allow(s.id, time.Now()) {
+		return
+	}
+	request := s.context.Request.HTTPRequest
+	admin.Touch(s.context, s.id, clientIP(request), request.UserAgent())
+}
+
+// tag current session with user id, so it can be find and revoke by user in SessionAdmin
+// if there is no session yet, a new one will be make now
+func (c *Context) TagSession(userId string) error {
+	admin := c.pong.sessionAdmin
+	if admin == nil {
+		return ErrorNoSessionAdmin
+	}
+	s := c.Session
+	s.load()
+	if len(s.id) == 0 {
+		s.dirty = true
+	}
+	if err := s.Save(); err != nil {
+		return err
+	}
+	return admin.Tag(c, s.id, userId)
+}
+
+// mount a JSON API to manage sessions on router, protect the router by Middleware like authentication before mount it
+// id in the API is SessionIDHash of sessionId, sessionId itself is never send
+//
+//	GET    /sessions              list sessions, ?user= to only list sessions of a user
+//	GET    /sessions/count        count sessions, response {"count":n}
+//	GET    /sessions/:id          inspect a session
+//	DELETE /sessions/:id          revoke a session, response {"revoked":n}
+//	DELETE /sessions?user=        revoke all sessions of a user, response {"revoked":n}
+//	PUT    /sessions/:id/user     tag a session with user id in query user, response the session
+func MountSessionAdmin(router *Router, admin SessionAdmin) {
+	fail := func(c *Context, err error) {
+		c.pong.HTTPErrorHandle(err, c)
+	}
+	notFound := NewHTTPError(http.StatusNotFound, "session not found")
+	// hide sessionId in infos
+	hide := func(infos []SessionInfo) []SessionInfo {
+		for i := range infos {
+			infos[i].ID = SessionIDHash(infos[i].ID)
+		}
+		return infos
+	}
+	// find the session which id's hash is hash, return nil if not find
+	find := func(c *Context, hash string) (*SessionInfo, error) {
+		infos, err := admin.List(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if SessionIDHash(info.ID) == hash {
+				return &info, nil
+			}
+		}
+		return nil, nil
+	}
+	router.Get("/sessions", func(c *Context) {
+		var infos []SessionInfo
+		var err error
+		if userId := c.Request.Query("user"); len(userId) > 0 {
+			infos, err = ListSessionsOfUser(c, admin, userId)
+		} else {
+			infos, err = admin.List(c)
+		}
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		if infos == nil {
+			infos = []SessionInfo{}
+		}
+		c.Response.JSON(hide(infos))
+	})
+	router.Get("/sessions/count", func(c *Context) {
+		count, err := admin.Count(c)
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		c.Response.JSON(map[string]int{"count": count})
+	})
+	router.Get("/sessions/:id", func(c *Context) {
+		info, err := find(c, c.Request.Param("id"))
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		if info == nil {
+			fail(c, notFound)
+			return
+		}
+		info.ID = SessionIDHash(info.ID)
+		c.Response.JSON(info)
+	})
+	router.Delete("/sessions/:id", func(c *Context) {
+		hash := c.Request.Param("id")
+		revoked, err := admin.Revoke(c, func(info SessionInfo) bool {
+			return SessionIDHash(info.ID) == hash
+		})
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		if revoked == 0 {
+			fail(c, notFound)
+			return
+		}
+		c.Response.JSON(map[string]int{"revoked": revoked})
+	})
+	router.Delete("/sessions", func(c *Context) {
+		userId := c.Request.Query("user")
+		if len(userId) == 0 {
+			fail(c, NewHTTPError(http.StatusBadRequest, "query user is required"))
+			return
+		}
+		revoked, err := RevokeSessionsOfUser(c, admin, userId)
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		c.Response.JSON(map[string]int{"revoked": revoked})
+	})
+	router.Put("/sessions/:id/user", func(c *Context) {
+		userId := c.Request.Query("user")
+		if len(userId) == 0 {
+			fail(c, NewHTTPError(http.StatusBadRequest, "query user is required"))
+			return
+		}
+		info, err := find(c, c.Request.Param("id"))
+		if err == nil && info == nil {
+			err = notFound
+		}
+		if err == nil {
+			err = admin.Tag(c, info.ID, userId)
+		}
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		info.ID = SessionIDHash(info.ID)
+		info.UserID = userId
+		c.Response.JSON(info)
+	})
+}
@@ -0,0 +1,9 @@
+package pong
+
+// SessionCodec encode a session value to bytes and decode it back, used by session stores which keep session out of process
+// a codec should keep value's type, so value read from session has the same type as it's set
+// see package session/codec for gob, JSON and MessagePack codecs
+type SessionCodec interface {
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
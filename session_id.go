@@ -0,0 +1,120 @@
+package pong
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	// default random bytes in a sessionId make by RandomIDGenerator
+	defaultSessionIdSize = 32
+	// bytes of HMAC-SHA256 keep in a signed sessionId
+	sessionIdSignSize = 16
+	// separate random part and sign in a signed sessionId
+	sessionIdSignSeparator = "."
+)
+
+// this error will be return when SignedIDGenerator has no key to sign sessionId
+var ErrorNoSignKey = errors.New("SignedIDGenerator need at least one key")
+
+// IDGenerator generate sessionId for session store and validate sessionId in request's cookie
+// invalid sessionId will be treat as no session, so garbage value never hit session store
+// give the same IDGenerator to session store and SessionOptions if it's not the default one
+type IDGenerator interface {
+	// generate a new sessionId, it should be safe to store in cookie
+	NewID() (string, error)
+	// return whether the id can be make by this IDGenerator
+	Valid(id string) bool
+}
+
+// RandomIDGenerator make sessionId from crypto random bytes encode by URL safe base64 without padding
+type RandomIDGenerator struct {
+	// how many random bytes in a sessionId, default is 32
+	Size int
+}
+
+func (g RandomIDGenerator) size() int {
+	if g.Size <= 0 {
+		return defaultSessionIdSize
+	}
+	return g.Size
+}
+
+func (g RandomIDGenerator) NewID() (string, error) {
+	bs := make([]byte, g.size())
+	if _, err := io.ReadFull(rand.Reader, bs); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+// id should has the right length and only URL safe base64 chars
+func (g RandomIDGenerator) Valid(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(g.size()) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.Strict().DecodeString(id)
+	return err == nil
+}
+
+// SignedIDGenerator append a HMAC-SHA256 sign to sessionId make by Generator
+// forged sessionId will be rejected by Valid before session store lookup
+type SignedIDGenerator struct {
+	// generate the random part of sessionId, default is RandomIDGenerator
+	Generator IDGenerator
+	// Keys[0] is used to sign new sessionId, and all of Keys are used to verify
+	// so to rotate key put the new key first and keep old keys after it until sessions sign by them expire
+	Keys [][]byte
+}
+
+func (g SignedIDGenerator) generator() IDGenerator {
+	if g.Generator == nil {
+		return RandomIDGenerator{}
+	}
+	return g.Generator
+}
+
+func sessionIdSign(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:sessionIdSignSize])
+}
+
+func (g SignedIDGenerator) NewID() (string, error) {
+	if len(g.Keys) == 0 {
+		return "", ErrorNoSignKey
+	}
+	id, err := g.generator().NewID()
+	if err != nil {
+		return "", err
+	}
+	return id + sessionIdSignSeparator + sessionIdSign(g.Keys[0], id), nil
+}
+
+func (g SignedIDGenerator) Valid(signedId string) bool {
+	index := strings.LastIndex(signedId, sessionIdSignSeparator)
+	if index < 0 {
+		return false
+	}
+	id, sign := signedId[:index], signedId[index+1:]
+	if !g.generator().Valid(id) {
+		return false
+	}
+	for _, key := range g.Keys {
+		if hmac.Equal([]byte(sessionIdSign(key, id)), []byte(sign)) {
+			return true
+		}
+	}
+	return false
+}
+
+// session store which generate sessionId by IDGenerator can implement it,
+// so pong can validate sessionId in cookie by the same IDGenerator
+type IDGeneratorOwner interface {
+	IDGenerator() IDGenerator
+}
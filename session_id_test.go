@@ -0,0 +1,117 @@
+package pong
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRandomIDGenerator(t *testing.T) {
+	g := RandomIDGenerator{}
+	ids := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id, err := g.NewID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != 43 || ids[id] || !g.Valid(id) {
+			t.Fatal(id)
+		}
+		ids[id] = true
+	}
+	for _, id := range []string{"", "short", strings.Repeat("a", 42) + "=", strings.Repeat("a", 42) + "/", strings.Repeat("a", 44)} {
+		if g.Valid(id) {
+			t.Error("should be invalid", id)
+		}
+	}
+	small := RandomIDGenerator{Size: 8}
+	id, _ := small.NewID()
+	if len(id) != 11 || !small.Valid(id) || g.Valid(id) {
+		t.Error(id)
+	}
+}
+
+func TestSignedIDGenerator(t *testing.T) {
+	oldKey, newKey := []byte("old-key"), []byte("new-key")
+	g := SignedIDGenerator{Keys: [][]byte{oldKey}}
+	id, err := g.NewID()
+	if err != nil || !g.Valid(id) {
+		t.Fatal(id, err)
+	}
+	random := id[:strings.LastIndex(id, ".")]
+	forged := []string{random, random + ".", random + ".AAAAAAAAAAAAAAAAAAAAAA", strings.Repeat("a", 43) + id[len(random):]}
+	for _, f := range forged {
+		if g.Valid(f) {
+			t.Error("forged id should be invalid", f)
+		}
+	}
+	if (SignedIDGenerator{Keys: [][]byte{newKey}}).Valid(id) {
+		t.Error("id sign by other key should be invalid")
+	}
+	rotated := SignedIDGenerator{Keys: [][]byte{newKey, oldKey}}
+	if !rotated.Valid(id) {
+		t.Error("id sign by old key should be valid after rotation")
+	}
+	newId, _ := rotated.NewID()
+	if g.Valid(newId) || !rotated.Valid(newId) {
+		t.Error("new id should be sign by first key", newId)
+	}
+	if _, err = (SignedIDGenerator{}).NewID(); err != ErrorNoSignKey {
+		t.Error(err)
+	}
+}
+
+// a SessionStore only has one session, record sessionId read
+type oneSessionStore struct {
+	failSessionStore
+	generator IDGenerator
+	id        string
+	read      []string
+}
+
+func (s *oneSessionStore) IDGenerator() IDGenerator {
+	return s.generator
+}
+
+func (s *oneSessionStore) Read(ctx context.Context, sessionId string) (map[string]interface{}, error) {
+	s.read = append(s.read, sessionId)
+	if sessionId == s.id {
+		return map[string]interface{}{"name": "pong"}, nil
+	}
+	return nil, nil
+}
+
+func TestValidateSessionId(t *testing.T) {
+	generator := SignedIDGenerator{Keys: [][]byte{[]byte("key")}}
+	id, _ := generator.NewID()
+	store := &oneSessionStore{generator: generator, id: id}
+	po, baseURL := runPong()
+	po.EnableSessionStore(store)
+	po.Root.Get("/get", func(c *Context) {
+		c.Response.String(c.Session.GetString("name", ""))
+	})
+	get := func(sessionId string) {
+		req, _ := http.NewRequest(http.MethodGet, baseURL+"/get", nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookiesName, Value: sessionId})
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Error(res.StatusCode)
+		}
+	}
+	random, _ := RandomIDGenerator{}.NewID()
+	for _, sessionId := range []string{"garbage", "../../etc/passwd", random, random + ".forged"} {
+		get(sessionId)
+	}
+	if len(store.read) != 0 {
+		t.Error("invalid sessionId should not hit store", store.read)
+	}
+	get(id)
+	if len(store.read) != 1 || store.read[0] != id {
+		t.Error(store.read)
+	}
+}
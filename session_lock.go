@@ -0,0 +1,49 @@
+package pong
+
+import (
+	"context"
+	"errors"
+)
+
+// SessionLocker is an optional interface a SessionIO or SessionStore can implement to lock a session by sessionId
+// when SessionOptions.Lock is true, pong lock the session before read it and unlock after it's changes are saved,
+// so concurrent requests of the same session like parallel XHRs are serialized and read-modify-write like counter and cart will not lose update
+type SessionLocker interface {
+	// lock the session, block until lock is acquired or ctx is done
+	// return ctx.Err() if ctx is done before lock is acquired, unlock should be called once to release the lock
+	Lock(ctx context.Context, sessionId string) (unlock func(), err error)
+}
+
+// return the SessionLocker implement by store, v1 SessionIO adapt by AdaptSessionIO is unwrapped
+// return nil if store can't lock session
+func SessionLockerOf(store SessionStore) SessionLocker {
+	if adapter, ok := store.(sessionIOAdapter); ok {
+		locker, _ := adapter.SessionIO.(SessionLocker)
+		return locker
+	}
+	locker, _ := store.(SessionLocker)
+	return locker
+}
+
+// lock session by sessionId, wait SessionOptions.LockTimeout at most
+func (s *Session) lock(sessionId string) error {
+	ctx, cancel := context.WithTimeout(s.context, s.pong.sessionOptions.LockTimeout)
+	defer cancel()
+	unlock, err := s.pong.sessionLocker.Lock(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrorSessionLockTimeout
+		}
+		return err
+	}
+	s.unlock = unlock
+	return nil
+}
+
+// release session's lock if it's locked, it's safe to call more than once
+func (s *Session) release() {
+	if s.unlock != nil {
+		s.unlock()
+		s.unlock = nil
+	}
+}
@@ -0,0 +1,206 @@
+package pong
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"time"
+)
+
+// session value names used by pong itself start with sessionInternalPrefix, they are not include in Session.Keys
+const (
+	sessionInternalPrefix = "_pong_"
+	// user id set by Context.Login
+	sessionUserName = sessionInternalPrefix + "user"
+	// unix seconds when session is created, used by SessionOptions.AbsoluteTimeout
+	sessionCreatedName = sessionInternalPrefix + "created"
+	// fingerprint of client's User-Agent, used by SessionBinding.UserAgent
+	sessionUserAgentName = sessionInternalPrefix + "ua"
+	// client IP prefix, used by SessionBinding.IPv4Prefix and SessionBinding.IPv6Prefix
+	sessionIPName = sessionInternalPrefix + "ip"
+)
+
+// SessionBinding bind session to something about the client, so a stolen sessionId is useless on other client
+// a session accessed by a client not match is treat as not exist, and a new session will be make for the client
+type SessionBinding struct {
+	// bind session to client's User-Agent
+	UserAgent bool
+	// bind session to client's IPv4 prefix in bits like 24, 0 means IPv4 is not bind
+	IPv4Prefix int
+	// bind session to client's IPv6 prefix in bits like 64, 0 means IPv6 is not bind
+	IPv6Prefix int
+	// if Strict is true session not match is destroyed, so neither the attacker nor the real user can use it any more
+	// else it's only ignored in the request not match, and the real user can still use it
+	Strict bool
+	// return client's IP, default is the host of request's RemoteAddr
+	// set it if pong is behind a proxy, read IP from header only if the proxy is trusted
+	ClientIP func(c *Context) string
+}
+
+func (binding *SessionBinding) enabled() bool {
+	return binding.UserAgent || binding.IPv4Prefix > 0 || binding.IPv6Prefix > 0
+}
+
+// return client's User-Agent fingerprint, empty if User-Agent is not bind
+func (binding *SessionBinding) userAgent(c *Context) string {
+	if !binding.UserAgent {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(c.Request.HTTPRequest.UserAgent()))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// return client's IP prefix, empty if client's IP type is not bind
+func (binding *SessionBinding) ipPrefix(c *Context) string {
+	var ip string
+	if binding.ClientIP != nil {
+		ip = binding.ClientIP(c)
+	} else {
+		ip = clientIP(c.Request.HTTPRequest)
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		if binding.IPv4Prefix <= 0 {
+			return ""
+		}
+		return v4.Mask(net.CIDRMask(binding.IPv4Prefix, 32)).String()
+	}
+	if binding.IPv6Prefix <= 0 {
+		return ""
+	}
+	return parsed.Mask(net.CIDRMask(binding.IPv6Prefix, 128)).String()
+}
+
+// whether a value is session's metadata record by pong, it's keep by Session.Clear
+func isSessionMeta(name string) bool {
+	return name == sessionCreatedName || name == sessionUserAgentName || name == sessionIPName
+}
+
+// set a value used by pong itself, it will be Save like value set by Set
+func (s *Session) setInternal(name string, value interface{}) {
+	s.store[name] = value
+	if s.changes == nil {
+		s.changes = make(map[string]interface{})
+	}
+	s.changes[name] = value
+	delete(s.deletes, name)
+	s.dirty = true
+}
+
+// record session's created time and bind it to current client
+// created time is only set once, so Regenerate can't extend AbsoluteTimeout
+func (s *Session) stamp() {
+	options := s.pong.sessionOptions
+	if options.AbsoluteTimeout > 0 {
+		if _, has := s.store[sessionCreatedName]; !has {
+			s.setInternal(sessionCreatedName, time.Now().Unix())
+		}
+	}
+	binding := &options.Binding
+	if binding.enabled() {
+		s.setInternal(sessionUserAgentName, binding.userAgent(s.context))
+		s.setInternal(sessionIPName, binding.ipPrefix(s.context))
+	}
+}
+
+// check session's absolute lifetime and binding just after it's loaded
+// session not pass is dropped so a new one will be make, return whether session pass
+func (s *Session) verify() bool {
+	options := s.pong.sessionOptions
+	binding := &options.Binding
+	if options.AbsoluteTimeout <= 0 && !binding.enabled() {
+		return true
+	}
+	if options.AbsoluteTimeout > 0 {
+		if _, has := s.store[sessionCreatedName]; !has {
+			// session made before AbsoluteTimeout is set, start to count from now
+			s.setInternal(sessionCreatedName, time.Now().Unix())
+		} else if created := time.Unix(int64(s.GetInt(sessionCreatedName, 0)), 0); time.Since(created) > options.AbsoluteTimeout {
+			s.drop(true)
+			return false
+		}
+	}
+	if binding.enabled() {
+		userAgent, hasUserAgent := s.store[sessionUserAgentName]
+		ip, hasIP := s.store[sessionIPName]
+		if !hasUserAgent || !hasIP {
+			// session made before Binding is set, bind it to current client
+			s.stamp()
+		} else if userAgent != binding.userAgent(s.context) || ip != binding.ipPrefix(s.context) {
+			s.drop(binding.Strict)
+			return false
+		}
+	}
+	return true
+}
+
+// drop loaded session so this request works like it has no session
+// if destroy is true, session is also removed from session manager, session store in cookie can't be destroyed
+func (s *Session) drop(destroy bool) {
+	if destroy && len(s.id) > 0 && s.pong.sessionCookieIO == nil {
+		s.pong.sessionStore.Destory(s.context, s.id)
+	}
+	s.release()
+	s.id = ""
+	s.store = make(map[string]interface{})
+	s.changes = nil
+	s.deletes = nil
+	s.dirty = false
+}
+
+// give this session a new sessionId and keep it's value, call it when user's privilege changes like login to prevent session fixation
+// session is bind to current client again if SessionOptions.Binding is set
+// if there is no session yet, a new one will be make before response is send
+func (s *Session) Regenerate() error {
+	s.load()
+	if len(s.id) == 0 {
+		s.dirty = true
+		return nil
+	}
+	if err := s.Save(); err != nil {
+		return err
+	}
+	c := s.context
+	newId, err := c.pong.sessionStore.Reset(c, s.id)
+	if err != nil {
+		return err
+	}
+	s.id = newId
+	s.stamp()
+	if c.pong.sessionCookieIO != nil {
+		// cookie will be Save before response
+		s.dirty = true
+		return nil
+	}
+	//send new sessionID to client
+	c.sessionTransportOf().Write(c, newId)
+	return nil
+}
+
+// return user id set by Context.Login, empty if not login
+func (s *Session) UserID() string {
+	return s.GetString(sessionUserName, "")
+}
+
+// login user to current session, sessionId is regenerated to prevent session fixation
+// if session store is a SessionAdmin session is also tag with userId, so it can be revoke by user
+func (c *Context) Login(userId string) error {
+	if err := c.Session.Regenerate(); err != nil {
+		return err
+	}
+	if err := c.Session.Put(sessionUserName, userId); err != nil {
+		return err
+	}
+	if c.pong.sessionAdmin != nil {
+		return c.TagSession(userId)
+	}
+	return nil
+}
+
+// logout user by destroy current session
+func (c *Context) Logout() error {
+	return c.DestorySession()
+}
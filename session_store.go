@@ -0,0 +1,66 @@
+package pong
+
+import (
+	"context"
+)
+
+// SessionStore is the v2 of SessionIO, every method take a context.Context and return error
+// so a store failure like redis outage can be told from session not exist
+// pong will give error happen when load session to HTTPErrorHandle instead of make a new session
+type SessionStore interface {
+	// generate a sessionId which is unique compare to existent and make a empty session for it
+	// this sessionId string will store in browser by cookies,so the sessionId string should compatible with cookies value rule
+	NewSession(ctx context.Context) (sessionId string, err error)
+	// remove an session's data in store by give sessionId
+	Destory(ctx context.Context, sessionId string) error
+	// update the give old sessionId to a new id,but the value should be the same
+	Reset(ctx context.Context, oldSessionId string) (newSessionId string, err error)
+	// read the whole value point to the give sessionId
+	// if session is not exist or has expired, return nil wholeValue and nil error
+	Read(ctx context.Context, sessionId string) (wholeValue map[string]interface{}, err error)
+	// update the sessionId's value to store
+	// the give value just has changed part not all of the value point to sessionId
+	Write(ctx context.Context, sessionId string, changes map[string]interface{}) error
+	// remove values by names from the sessionId's value in store, names not exist should be ignore
+	Delete(ctx context.Context, sessionId string, names ...string) error
+}
+
+// make a v1 SessionIO works as SessionStore
+// because SessionIO can't report error, empty sessionId return by NewSession is treat as ErrorNewSession
+func AdaptSessionIO(sessionIO SessionIO) SessionStore {
+	return sessionIOAdapter{sessionIO}
+}
+
+type sessionIOAdapter struct {
+	SessionIO
+}
+
+func (adapter sessionIOAdapter) NewSession(ctx context.Context) (string, error) {
+	if sessionId := adapter.SessionIO.NewSession(); len(sessionId) > 0 {
+		return sessionId, nil
+	}
+	return "", ErrorNewSession
+}
+
+func (adapter sessionIOAdapter) Destory(ctx context.Context, sessionId string) error {
+	return adapter.SessionIO.Destory(sessionId)
+}
+
+func (adapter sessionIOAdapter) Reset(ctx context.Context, oldSessionId string) (string, error) {
+	return adapter.SessionIO.Reset(oldSessionId)
+}
+
+func (adapter sessionIOAdapter) Read(ctx context.Context, sessionId string) (map[string]interface{}, error) {
+	if !adapter.SessionIO.Has(sessionId) {
+		return nil, nil
+	}
+	return adapter.SessionIO.Read(sessionId), nil
+}
+
+func (adapter sessionIOAdapter) Write(ctx context.Context, sessionId string, changes map[string]interface{}) error {
+	return adapter.SessionIO.Write(sessionId, changes)
+}
+
+func (adapter sessionIOAdapter) Delete(ctx context.Context, sessionId string, names ...string) error {
+	return adapter.SessionIO.Delete(sessionId, names...)
+}
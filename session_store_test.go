@@ -0,0 +1,103 @@
+package pong
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errTestStore = errors.New("store fail")
+
+// a SessionStore always fail
+type failSessionStore struct{}
+
+func (failSessionStore) NewSession(ctx context.Context) (string, error) {
+	return "", errTestStore
+}
+
+func (failSessionStore) Destory(ctx context.Context, sessionId string) error {
+	return errTestStore
+}
+
+func (failSessionStore) Reset(ctx context.Context, oldSessionId string) (string, error) {
+	return "", errTestStore
+}
+
+func (failSessionStore) Read(ctx context.Context, sessionId string) (map[string]interface{}, error) {
+	return nil, errTestStore
+}
+
+func (failSessionStore) Write(ctx context.Context, sessionId string, changes map[string]interface{}) error {
+	return errTestStore
+}
+
+func (failSessionStore) Delete(ctx context.Context, sessionId string, names ...string) error {
+	return errTestStore
+}
+
+func TestSessionStoreError(t *testing.T) {
+	po, baseURL := runPong()
+	po.EnableSessionStore(failSessionStore{})
+	root := po.Root
+	root.Get("/get", func(c *Context) {
+		c.Session.Get("name")
+		t.Error("handle should stop when session load fail")
+	})
+	root.Get("/static", func(c *Context) {
+		c.Response.String("static")
+	})
+	root.Get("/set", func(c *Context) {
+		c.Session.Put("name", "pong")
+		if err := c.Session.Save(); err != errTestStore {
+			t.Error(err)
+		}
+		c.Response.String("set")
+	})
+	request := func(path string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, baseURL+path, nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookiesName, Value: "sid"})
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+	if res := request("/get"); res.StatusCode != http.StatusInternalServerError || len(res.Cookies()) != 0 {
+		t.Error(res.StatusCode, res.Cookies())
+	}
+	// session not accessed, store is not touched
+	if res := request("/static"); res.StatusCode != http.StatusOK {
+		t.Error(res.StatusCode)
+	}
+	res, err := http.Get(baseURL + "/set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	// changes still fail to be write before response is send, the error is give to HTTPErrorHandle
+	if res.StatusCode != http.StatusInternalServerError || len(res.Cookies()) != 0 {
+		t.Error("no cookie should be set when new session fail", res.StatusCode, res.Cookies())
+	}
+}
+
+func TestSessionStoreErrorInTimeout(t *testing.T) {
+	po, baseURL := runPong()
+	po.EnableSessionStore(failSessionStore{})
+	po.Root.Get("/get", Timeout(time.Second, func(c *Context) {
+		c.Session.Get("name")
+		t.Error("handle should stop when session load fail")
+	}))
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/get", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookiesName, Value: "sid"})
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Error(res.StatusCode)
+	}
+}
@@ -0,0 +1,115 @@
+package pong
+
+import (
+	"net/http"
+	"strings"
+)
+
+// default header name used by HeaderTransport and BearerTransport to send sessionId to client
+const SessionTokenHeader = "X-Session-Token"
+
+// SessionTransport define how sessionId is carried between client and server
+// default is CookieTransport, use HeaderTransport or BearerTransport for API clients like mobile apps and CLI tools which don't keep cookies
+// if session is store in cookie by SessionCookieIO, the whole encoded session is carried instead of sessionId
+type SessionTransport interface {
+	// read sessionId from request, return empty string if request has no sessionId
+	Read(c *Context) string
+	// send sessionId to client, it's called when a new session is made or sessionId is reset
+	Write(c *Context, sessionId string)
+	// tell client to forget sessionId, it's called when session is destroyed
+	Clear(c *Context)
+}
+
+// CookieTransport store sessionId in browser's cookie, cookie is config by SessionOptions
+type CookieTransport struct{}
+
+func (CookieTransport) Read(c *Context) string {
+	cookie, err := c.Request.HTTPRequest.Cookie(c.pong.sessionOptions.CookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func (CookieTransport) Write(c *Context, sessionId string) {
+	c.Response.Cookie(c.pong.sessionOptions.cookie(sessionId))
+}
+
+func (CookieTransport) Clear(c *Context) {
+	c.Response.Cookie(c.pong.sessionOptions.expiredCookie())
+}
+
+// HeaderTransport read sessionId from request header Name,
+// and echo sessionId back in response header Name when session is made or reset
+// when session is destroyed response header Name is send with empty value, client should forget it's sessionId
+type HeaderTransport struct {
+	// header's name, default is SessionTokenHeader
+	Name string
+}
+
+func (t HeaderTransport) name() string {
+	if len(t.Name) == 0 {
+		return SessionTokenHeader
+	}
+	return t.Name
+}
+
+func (t HeaderTransport) Read(c *Context) string {
+	return c.Request.HTTPRequest.Header.Get(t.name())
+}
+
+func (t HeaderTransport) Write(c *Context, sessionId string) {
+	c.Response.Header(t.name(), sessionId)
+}
+
+func (t HeaderTransport) Clear(c *Context) {
+	c.Response.Header(t.name(), "")
+}
+
+// BearerTransport read sessionId from request header `Authorization: Bearer <sessionId>`,
+// and send sessionId to client in response header ResponseHeader like HeaderTransport
+type BearerTransport struct {
+	// response header's name to send sessionId, default is SessionTokenHeader
+	ResponseHeader string
+}
+
+func (t BearerTransport) header() HeaderTransport {
+	return HeaderTransport{Name: t.ResponseHeader}
+}
+
+func (t BearerTransport) Read(c *Context) string {
+	return bearerToken(c.Request.HTTPRequest)
+}
+
+func (t BearerTransport) Write(c *Context, sessionId string) {
+	t.header().Write(c, sessionId)
+}
+
+func (t BearerTransport) Clear(c *Context) {
+	t.header().Clear(c)
+}
+
+// set the SessionTransport used by every handle register in this router and it's sub routers
+// a sub router can set it's own transport to overwrite parent's, so /api and web UI can carry sessionId in different ways
+// if session is accessed in a parent router's Middleware, it's loaded by parent's transport
+func (r *Router) SessionTransport(transport SessionTransport) {
+	r.sessionTransport = transport
+}
+
+// return the SessionTransport of the router handle this request, default is SessionOptions.Transport
+func (c *Context) sessionTransportOf() SessionTransport {
+	if c.sessionTransport != nil {
+		return c.sessionTransport
+	}
+	return c.pong.sessionOptions.Transport
+}
+
+// return token in request header `Authorization: Bearer <token>`, auth scheme is case insensitive
+func bearerToken(request *http.Request) string {
+	const prefix = "bearer "
+	auth := request.Header.Get("Authorization")
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(auth[len(prefix):])
+}
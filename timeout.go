@@ -0,0 +1,183 @@
+package pong
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeoutWriter buffer everything a handle write, so a timeout handle never send half response to client
+// after timeout every write will be discarded and return http.ErrHandlerTimeout
+type timeoutWriter struct {
+	lock        sync.Mutex
+	header      http.Header
+	buffer      bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+	// whether the handle has return
+	finished bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.code = code
+}
+
+func (tw *timeoutWriter) Write(bs []byte) (int, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.buffer.Write(bs)
+}
+
+// copy buffered response to writer, code is used when handle write body without call WriteHeader
+func (tw *timeoutWriter) flushTo(writer http.ResponseWriter, code int) {
+	header := writer.Header()
+	for k := range header {
+		delete(header, k)
+	}
+	for k, v := range tw.header {
+		header[k] = v
+	}
+	if tw.wroteHeader {
+		writer.WriteHeader(tw.code)
+	} else if tw.buffer.Len() > 0 {
+		writer.WriteHeader(code)
+	}
+	writer.Write(tw.buffer.Bytes())
+}
+
+// fork make a new Context which own response writer,used to response when the handle running in this Context has timeout
+// Session is not copy because it's still used by the timeout handle, BeforeSend and AfterSend handles are copy to run with the fork
+// the fork has it's own responseWriter, so Response.Committed and Response.Size in the timeout handle never race with it
+func (c *Context) fork(request *http.Request) *Context {
+	writer := c.Response.writer
+	fork := &Context{
+		pong:      c.pong,
+		dataStore: make(map[interface{}]interface{}),
+		Request: &Request{
+			HTTPRequest:     request,
+			requestParamMap: c.Request.requestParamMap,
+		},
+		Response: &Response{
+			StatusCode: http.StatusOK,
+			writer: &responseWriter{
+				ResponseWriter: writer.ResponseWriter,
+				committed:      writer.committed,
+				hijacked:       writer.hijacked,
+				size:           writer.size,
+			},
+			beforeSendList: append([]HandleFunc(nil), c.Response.beforeSendList...),
+			afterSendList:  append([]HandleFunc(nil), c.Response.afterSendList...),
+		},
+	}
+	c.dataLock.RLock()
+	for k, v := range c.dataStore {
+		fork.dataStore[k] = v
+	}
+	c.dataLock.RUnlock()
+	fork.Response.context = fork
+	fork.Response.HTTPResponseWriter = fork.Response.writer
+	fork.Response.writer.response = fork.Response
+	c.forked = fork
+	return fork
+}
+
+// return the Context which response to client, it's the fork if the handle has timeout
+func (c *Context) sender() *Context {
+	if c.forked != nil {
+		return c.forked
+	}
+	return c
+}
+
+// run handle in a new goroutine and wait it finish in timeout
+// if timeout, request's context will be canceled and HTTPErrorHandle will be called with ErrorHandleTimeout
+// if request is canceled before timeout, like client has gone, HTTPErrorHandle will be called with ErrorRequestCanceled
+func (c *Context) runWithTimeout(timeout time.Duration, handle HandleFunc) {
+	cancel := c.WithTimeout(timeout)
+	defer cancel()
+	request := c.Request.HTTPRequest
+	res := c.Response
+	writer := res.HTTPResponseWriter
+	tw := &timeoutWriter{
+		header: make(http.Header),
+	}
+	for k, v := range writer.Header() {
+		tw.header[k] = v
+	}
+	res.HTTPResponseWriter = tw
+	done := make(chan struct{})
+	panicChan := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			tw.lock.Lock()
+			tw.finished = true
+			timedOut := tw.timedOut
+			tw.lock.Unlock()
+			if timedOut {
+				// response has been send by fork, only this goroutine can still use Session, release it's lock here
+				releaseSession(c)
+			}
+			if p := recover(); p != nil {
+				panicChan <- p
+			}
+		}()
+		handle(c)
+		close(done)
+	}()
+	select {
+	case p := <-panicChan:
+		res.HTTPResponseWriter = writer
+		panic(p)
+	case <-done:
+		res.HTTPResponseWriter = writer
+		tw.flushTo(writer, res.StatusCode)
+	case <-request.Context().Done():
+		tw.lock.Lock()
+		tw.timedOut = true
+		// the handle still running will release Session's lock when it return
+		c.sessionDetached = !tw.finished
+		tw.lock.Unlock()
+		// response by a fork, so the handle still running can't race with it
+		fork := c.fork(request)
+		if request.Context().Err() == context.DeadlineExceeded {
+			c.pong.HTTPErrorHandle(ErrorHandleTimeout, fork)
+		} else {
+			// client has gone or request is canceled by others, the response is only seen by AfterResponse handles and logs
+			c.pong.HTTPErrorHandle(ErrorRequestCanceled, fork)
+		}
+	}
+}
+
+// wrap a handle with timeout
+// if the handle can't finish in timeout, request's context will be canceled, then HTTPErrorHandle will be called with ErrorHandleTimeout,
+// default HTTPErrorHandle will response with code 503, define your HTTPErrorHandle to response something else like 504.
+// everything the timeout handle write will be discarded, write to Response after timeout will return http.ErrHandlerTimeout
+// the handle's response is buffered before send, so it can't be used to streaming response
+func Timeout(timeout time.Duration, handle HandleFunc) HandleFunc {
+	return func(c *Context) {
+		c.runWithTimeout(timeout, handle)
+	}
+}
+
+// set a timeout to every handle register in this router and it's sub routers
+// a sub router can set it's own timeout to overwrite parent's, a negative timeout disable parent's timeout for the sub router,
+// works like pong.Timeout
+func (r *Router) Timeout(timeout time.Duration) {
+	r.timeout = timeout
+}
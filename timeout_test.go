@@ -0,0 +1,164 @@
+package pong
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterTimeout(t *testing.T) {
+	po, baseURL := runPong()
+	root := po.Root
+	sub := root.Router("/sub")
+	sub.Timeout(20 * time.Millisecond)
+	lateWrite := make(chan error, 1)
+	sub.Get("/slow", func(c *Context) {
+		select {
+		case <-c.Done():
+		case <-time.After(time.Second):
+			t.Error("context should be canceled after timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, err := c.Response.HTTPResponseWriter.Write([]byte("late"))
+		lateWrite <- err
+	})
+	sub.Get("/fast", func(c *Context) {
+		c.Response.Header("X-name", "fast")
+		c.Response.StatusCode = http.StatusCreated
+		c.Response.String("fast")
+	})
+	defer func() {
+		res, err := http.Get(baseURL + "/sub/slow")
+		if err != nil {
+			t.Error(err)
+		} else {
+			bs, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != http.StatusServiceUnavailable || string(bs) != ErrorHandleTimeout.Message {
+				t.Error(res.StatusCode, string(bs))
+			}
+			if err := <-lateWrite; err != http.ErrHandlerTimeout {
+				t.Error(err)
+			}
+		}
+		res, err = http.Get(baseURL + "/sub/fast")
+		if err != nil {
+			t.Error(err)
+		} else {
+			bs, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if res.StatusCode != http.StatusCreated || string(bs) != "fast" || res.Header.Get("X-name") != "fast" {
+				t.Error(res.StatusCode, string(bs), res.Header)
+			}
+		}
+		t.Log(`TestRouterTimeout`)
+	}()
+}
+
+func TestTimeoutHandle(t *testing.T) {
+	po, baseURL := runPong()
+	root := po.Root
+	po.HTTPErrorHandle = func(err error, c *Context) {
+		if err == ErrorHandleTimeout {
+			c.Response.StatusCode = http.StatusGatewayTimeout
+		}
+		c.Response.String(err.Error())
+	}
+	root.Get("/slow", Timeout(10*time.Millisecond, func(c *Context) {
+		<-c.Done()
+		c.Response.String("slow")
+	}))
+	defer func() {
+		res, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			t.Error(err)
+		} else {
+			res.Body.Close()
+			if res.StatusCode != http.StatusGatewayTimeout {
+				t.Error(res.StatusCode)
+			}
+		}
+		t.Log(`TestTimeoutHandle`)
+	}()
+}
+
+func TestTimeoutRequestCanceled(t *testing.T) {
+	po := New()
+	var handleErr error
+	po.HTTPErrorHandle = func(err error, c *Context) {
+		handleErr = err
+		c.Response.StatusCode = err.(*HTTPError).StatusCode
+	}
+	release := make(chan bool)
+	finished := make(chan bool)
+	po.Root.Get("/slow", Timeout(time.Second, func(c *Context) {
+		// block until request has been canceled and response has been send
+		<-release
+		c.Response.String("slow")
+		close(finished)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder := httptest.NewRecorder()
+	po.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx))
+	close(release)
+	<-finished
+	if handleErr != ErrorRequestCanceled || recorder.Code != ErrorRequestCanceled.StatusCode || recorder.Body.Len() != 0 {
+		t.Error(handleErr, recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestTimeoutHandleReadResponse(t *testing.T) {
+	po := New()
+	stop := make(chan bool)
+	finished := make(chan bool)
+	po.Root.Get("/slow", Timeout(10*time.Millisecond, func(c *Context) {
+		// keep reading response state while the fork send timeout error
+		for {
+			select {
+			case <-stop:
+				if c.Response.Committed() || c.Response.Size() != 0 {
+					t.Error("timeout handle's response should never be send")
+				}
+				close(finished)
+				return
+			default:
+				c.Response.Committed()
+				c.Response.Size()
+			}
+		}
+	}))
+	recorder := httptest.NewRecorder()
+	po.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	close(stop)
+	<-finished
+	if recorder.Code != ErrorHandleTimeout.StatusCode || recorder.Body.String() != ErrorHandleTimeout.Message {
+		t.Error(recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRouterTimeoutDisabled(t *testing.T) {
+	po, baseURL := runPong()
+	po.Root.Timeout(10 * time.Millisecond)
+	sub := po.Root.Router("/sub")
+	sub.Timeout(-1)
+	handle := func(c *Context) {
+		time.Sleep(30 * time.Millisecond)
+		c.Response.String("done")
+	}
+	po.Root.Get("/slow", handle)
+	sub.Get("/slow", handle)
+	res, err := http.Get(baseURL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Error(res.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodGet, baseURL+"/sub/slow", nil)
+	assertBody(t, req, "done")
+}